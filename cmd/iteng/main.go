@@ -0,0 +1,137 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Command iteng renders and checks image templates.
+
+Usage:
+
+	iteng render [-strict] template.json inputs.json output.png
+	iteng validate template.json...
+	iteng schema [-inputs template.json] [-o file]
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bluelamar/image-template-engine-go/iteng"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n")
+	fmt.Fprintf(os.Stderr, "  iteng render [-strict] template.json inputs.json output.png\n")
+	fmt.Fprintf(os.Stderr, "  iteng validate template.json...\n")
+	fmt.Fprintf(os.Stderr, "  iteng schema [-inputs template.json] [-o file]\n")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "render":
+		err = render(os.Args[2:])
+	case "validate":
+		err = validate(os.Args[2:])
+	case "schema":
+		err = schema(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "iteng %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func render(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	strict := fs.Bool("strict", false, "fail instead of producing degraded output")
+	fs.Parse(args)
+	if fs.NArg() != 3 {
+		usage()
+	}
+
+	var opts []iteng.Option
+	if *strict {
+		opts = append(opts, iteng.WithStrict())
+	}
+
+	report, err := iteng.ImageDriverContext(context.Background(), fs.Arg(0), fs.Arg(1), fs.Arg(2), opts...)
+	if report != nil {
+		for _, sr := range report.Degraded() {
+			fmt.Fprintf(os.Stderr, "warning: slot %s: %s: %s\n", sr.ID, sr.Status, sr.Message)
+		}
+	}
+	return err
+}
+
+func validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		usage()
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		errs := iteng.ValidateFile(path)
+		for _, e := range errs {
+			fmt.Printf("%s: %v\n", path, e)
+		}
+		if len(errs) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d templates are invalid", failed, fs.NArg())
+	}
+	return nil
+}
+
+func schema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	inputs := fs.String("inputs", "", "print the inputs schema for this template instead of the template schema")
+	out := fs.String("o", "", "write the schema to this file instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		usage()
+	}
+
+	s := iteng.TemplateSchema()
+	if *inputs != "" {
+		tmpl, err := iteng.ParseTemplate(*inputs)
+		if err != nil {
+			return err
+		}
+		s = iteng.InputsSchema(tmpl)
+	}
+
+	b, err := iteng.MarshalSchema(s)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		return os.WriteFile(*out, b, 0644)
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
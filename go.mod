@@ -4,7 +4,9 @@ go 1.24.5
 
 require (
 	github.com/fogleman/gg v1.3.0
+	github.com/go-text/typesetting v0.2.1
 	golang.org/x/image v0.34.0
+	golang.org/x/text v0.32.0
 )
 
 require github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
@@ -0,0 +1,186 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// alphaOf returns the alpha channel of img
+func alphaOf(img image.Image) *image.Alpha {
+	b := img.Bounds()
+	m := image.NewAlpha(b)
+	draw.Draw(m, b, img, b.Min, draw.Src)
+	return m
+}
+
+// fillAlpha returns an image of color c shaped by the mask m
+func fillAlpha(m *image.Alpha, c color.Color) *image.RGBA {
+	img := image.NewRGBA(m.Bounds())
+	draw.DrawMask(img, img.Bounds(), image.NewUniform(c), image.Point{}, m, m.Bounds().Min, draw.Src)
+	return img
+}
+
+// dilateAlpha grows the shape of m by radius pixels in every direction,
+// with an anti-aliased edge
+func dilateAlpha(m *image.Alpha, radius float64) *image.Alpha {
+	out := image.NewAlpha(m.Bounds())
+	if radius <= 0 {
+		copy(out.Pix, m.Pix)
+		return out
+	}
+
+	// weights of the offsets whose pixel the grown shape covers, partly covered at the edge
+	type tap struct {
+		dx, dy int
+		w      float64
+	}
+	var taps []tap
+	r := int(math.Ceil(radius + 1))
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			w := radius + 1 - math.Hypot(float64(dx), float64(dy))
+			if w > 0 {
+				taps = append(taps, tap{dx, dy, math.Min(w, 1)})
+			}
+		}
+	}
+
+	// only pixels near the shape can be covered
+	b := m.Bounds()
+	ink := image.Rectangle{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if m.Pix[m.PixOffset(x, y)] != 0 {
+				ink = ink.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	area := ink.Inset(-r).Intersect(b)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			var v float64
+			for _, t := range taps {
+				sx, sy := x+t.dx, y+t.dy
+				if sx < b.Min.X || sx >= b.Max.X || sy < b.Min.Y || sy >= b.Max.Y {
+					continue
+				}
+				if a := float64(m.Pix[m.PixOffset(sx, sy)]) * t.w; a > v {
+					v = a
+				}
+			}
+			out.Pix[out.PixOffset(x, y)] = uint8(v + 0.5)
+		}
+	}
+	return out
+}
+
+// blurAlpha blurs m in place with a gaussian of standard deviation sigma,
+// approximated by three box blurs
+func blurAlpha(m *image.Alpha, sigma float64) {
+	if sigma <= 0 {
+		return
+	}
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	buf := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			buf[y*w+x] = float64(m.Pix[y*m.Stride+x])
+		}
+	}
+
+	tmp := make([]float64, w*h)
+	for _, size := range gaussBoxes(sigma, 3) {
+		boxBlur(buf, tmp, w, h, size/2, false)
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.Pix[y*m.Stride+x] = clampUint8(buf[y*w+x])
+		}
+	}
+}
+
+// gaussBoxes returns the sizes of n box blurs that approximate a gaussian blur
+func gaussBoxes(sigma float64, n int) []int {
+	wIdeal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	wl := int(math.Floor(wIdeal))
+	if wl%2 == 0 {
+		wl--
+	}
+	wu := wl + 2
+	mIdeal := (12*sigma*sigma - float64(n*wl*wl) - 4*float64(n*wl) - 3*float64(n)) / (-4*float64(wl) - 4)
+	m := int(math.Round(mIdeal))
+
+	sizes := make([]int, n)
+	for i := range sizes {
+		if i < m {
+			sizes[i] = wl
+		} else {
+			sizes[i] = wu
+		}
+	}
+	return sizes
+}
+
+// boxBlur blurs the w x h values in buf with a box of the given radius,
+// horizontally then vertically, using tmp as scratch space.
+// Values outside buf are treated as 0, or as the nearest edge value with clamp.
+func boxBlur(buf, tmp []float64, w, h, radius int, clamp bool) {
+	if radius <= 0 {
+		return
+	}
+	scale := 1 / float64(2*radius+1)
+	// line blurs the n values of src from start, step apart, into dst
+	line := func(src, dst []float64, start, step, n int) {
+		at := func(i int) float64 {
+			if i < 0 || i >= n {
+				if !clamp {
+					return 0
+				}
+				i = min(max(i, 0), n-1)
+			}
+			return src[start+i*step]
+		}
+		var sum float64
+		for i := -radius; i <= radius; i++ {
+			sum += at(i)
+		}
+		for i := 0; i < n; i++ {
+			dst[start+i*step] = sum * scale
+			sum += at(i+radius+1) - at(i-radius)
+		}
+	}
+	for y := 0; y < h; y++ {
+		line(buf, tmp, y*w, 1, w)
+	}
+	for x := 0; x < w; x++ {
+		line(tmp, buf, x, w, h)
+	}
+}
+
+func clampUint8(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
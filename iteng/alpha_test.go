@@ -0,0 +1,85 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"image"
+	"testing"
+)
+
+// dot returns a w x h mask with a single opaque pixel at x, y
+func dot(w, h, x, y int) *image.Alpha {
+	m := image.NewAlpha(image.Rect(0, 0, w, h))
+	m.Pix[m.PixOffset(x, y)] = 255
+	return m
+}
+
+func Test_dilateAlpha(t *testing.T) {
+	m := dilateAlpha(dot(21, 21, 10, 10), 3)
+
+	tests := []struct {
+		x, y int
+		min  uint8
+		max  uint8
+	}{
+		{10, 10, 255, 255}, // the original pixel
+		{13, 10, 255, 255}, // at the radius
+		{10, 7, 255, 255},
+		{12, 12, 255, 255}, // inside the circle
+		{15, 10, 0, 0},     // outside the radius
+		{13, 13, 0, 0},     // outside the circle
+	}
+	for _, test := range tests {
+		if a := m.AlphaAt(test.x, test.y).A; a < test.min || a > test.max {
+			t.Errorf("alpha at %d,%d = %d; expected %d..%d", test.x, test.y, a, test.min, test.max)
+		}
+	}
+}
+
+func Test_blurAlpha(t *testing.T) {
+	m := image.NewAlpha(image.Rect(0, 0, 41, 41))
+	for y := 15; y < 26; y++ {
+		for x := 15; x < 26; x++ {
+			m.Pix[m.PixOffset(x, y)] = 255
+		}
+	}
+	sum := func(m *image.Alpha) int {
+		total := 0
+		for _, a := range m.Pix {
+			total += int(a)
+		}
+		return total
+	}
+	before := sum(m)
+
+	blurAlpha(m, 3)
+
+	if a := m.AlphaAt(20, 20).A; a < 200 {
+		t.Errorf("alpha at the center = %d; expected the center to stay mostly opaque", a)
+	}
+	if a := m.AlphaAt(15, 20).A; a < 64 || a > 192 {
+		t.Errorf("alpha at the edge = %d; expected about half", a)
+	}
+	if a := m.AlphaAt(11, 20).A; a == 0 {
+		t.Errorf("alpha outside the square is 0; expected the blur to spread")
+	}
+	if a := m.AlphaAt(0, 0).A; a != 0 {
+		t.Errorf("alpha far from the square = %d; expected 0", a)
+	}
+	// the blur moves coverage around without adding or removing much
+	if after := sum(m); after < before*95/100 || after > before*105/100 {
+		t.Errorf("total alpha changed from %d to %d", before, after)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// BlendMode options
+// The option can be specified in the Slot struct as BlendMode field
+type BlendMode string
+
+// Blend modes as in CSS mix-blend-mode, where the slot is the source and
+// the canvas beneath it the backdrop
+// normal - the slot covers the backdrop
+// multiply - darkens, white leaves the backdrop as it is
+// screen - lightens, black leaves the backdrop as it is
+// overlay - multiplies the shadows and screens the highlights of the backdrop
+// soft-light - a gentler overlay, darkening or lightening by the slot
+// darken - the darker of the slot and the backdrop
+// lighten - the lighter of the slot and the backdrop
+// difference - the difference between the slot and the backdrop
+// color-dodge - brightens the backdrop to reflect the slot
+const (
+	BlendNormal     BlendMode = "normal"
+	BlendMultiply   BlendMode = "multiply"
+	BlendScreen     BlendMode = "screen"
+	BlendOverlay    BlendMode = "overlay"
+	BlendSoftLight  BlendMode = "soft-light"
+	BlendDarken     BlendMode = "darken"
+	BlendLighten    BlendMode = "lighten"
+	BlendDifference BlendMode = "difference"
+	BlendColorDodge BlendMode = "color-dodge"
+)
+
+// DrawBlend composites src onto dst inside r like draw.DrawMask with
+// draw.Over, mixing the colors of src with those beneath it by mode.
+// sp and mp are the points of src and mask aligned with r.Min, a nil mask
+// is opaque. Unknown modes and normal draw src over dst.
+func DrawBlend(dst *image.RGBA, r image.Rectangle, src image.Image, sp image.Point, mask image.Image, mp image.Point, mode BlendMode) {
+	blend := blendFunc(mode)
+	if blend == nil {
+		draw.DrawMask(dst, r, src, sp, mask, mp, draw.Over)
+		return
+	}
+
+	clipped := r.Intersect(dst.Bounds())
+	for y := clipped.Min.Y; y < clipped.Max.Y; y++ {
+		for x := clipped.Min.X; x < clipped.Max.X; x++ {
+			sx, sy := sp.X+x-r.Min.X, sp.Y+y-r.Min.Y
+			if !(image.Point{sx, sy}.In(src.Bounds())) {
+				continue
+			}
+			sr, sg, sb, sa := src.At(sx, sy).RGBA()
+			m := uint32(0xffff)
+			if mask != nil {
+				_, _, _, m = mask.At(mp.X+x-r.Min.X, mp.Y+y-r.Min.Y).RGBA()
+			}
+			if sa == 0 || m == 0 {
+				continue
+			}
+
+			// premultiplied source with the mask applied, from 0 to 1
+			k := float64(m) / 0xffff / 0xffff
+			as := float64(sa) * k
+			cs := [3]float64{float64(sr) * k, float64(sg) * k, float64(sb) * k}
+
+			i := dst.PixOffset(x, y)
+			px := dst.Pix[i : i+4 : i+4]
+			ab := float64(px[3]) / 255
+			cb := [3]float64{float64(px[0]) / 255, float64(px[1]) / 255, float64(px[2]) / 255}
+
+			// co = (1 - ab) Cs + (1 - as) Cb + as ab B(cb, cs), premultiplied
+			for c := 0; c < 3; c++ {
+				mixed := 0.0
+				if as > 0 && ab > 0 {
+					mixed = as * ab * blend(cb[c]/ab, cs[c]/as)
+				}
+				px[c] = clampUint8(((1-ab)*cs[c] + (1-as)*cb[c] + mixed) * 255)
+			}
+			px[3] = clampUint8((as + ab*(1-as)) * 255)
+		}
+	}
+}
+
+// blendFunc returns the blend of unpremultiplied backdrop and source
+// channels for mode, or nil for normal and unknown modes
+func blendFunc(mode BlendMode) func(cb, cs float64) float64 {
+	switch BlendMode(strings.ToLower(string(mode))) {
+	case BlendMultiply:
+		return func(cb, cs float64) float64 { return cb * cs }
+	case BlendScreen:
+		return screen
+	case BlendOverlay:
+		// hard light with the layers swapped
+		return func(cb, cs float64) float64 {
+			if cb <= 0.5 {
+				return cs * 2 * cb
+			}
+			return screen(2*cb-1, cs)
+		}
+	case BlendSoftLight:
+		return func(cb, cs float64) float64 {
+			if cs <= 0.5 {
+				return cb - (1-2*cs)*cb*(1-cb)
+			}
+			d := math.Sqrt(cb)
+			if cb <= 0.25 {
+				d = ((16*cb-12)*cb + 4) * cb
+			}
+			return cb + (2*cs-1)*(d-cb)
+		}
+	case BlendDarken:
+		return math.Min
+	case BlendLighten:
+		return math.Max
+	case BlendDifference:
+		return func(cb, cs float64) float64 { return math.Abs(cb - cs) }
+	case BlendColorDodge:
+		return func(cb, cs float64) float64 {
+			switch {
+			case cb == 0:
+				return 0
+			case cs >= 1:
+				return 1
+			}
+			return math.Min(1, cb/(1-cs))
+		}
+	}
+	return nil
+}
+
+func screen(cb, cs float64) float64 {
+	return cb + cs - cb*cs
+}
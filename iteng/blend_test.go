@@ -0,0 +1,121 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func Test_DrawBlend(t *testing.T) {
+	backdrop := color.RGBA{200, 100, 50, 255}
+	source := color.RGBA{100, 100, 200, 255}
+	tests := []struct {
+		mode BlendMode
+		want color.RGBA
+	}{
+		{BlendMultiply, color.RGBA{78, 39, 39, 255}},
+		{BlendScreen, color.RGBA{222, 161, 211, 255}},
+		{BlendOverlay, color.RGBA{189, 78, 78, 255}},
+		{BlendSoftLight, color.RGBA{191, 87, 86, 255}},
+		{BlendDarken, color.RGBA{100, 100, 50, 255}},
+		{BlendLighten, color.RGBA{200, 100, 200, 255}},
+		{BlendDifference, color.RGBA{100, 0, 150, 255}},
+		{BlendColorDodge, color.RGBA{255, 164, 232, 255}},
+		{"Multiply", color.RGBA{78, 39, 39, 255}},
+	}
+	near := func(a, b color.RGBA) bool {
+		d := func(x, y uint8) bool { return int(x)-int(y) <= 1 && int(y)-int(x) <= 1 }
+		return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && a.A == b.A
+	}
+	for _, tt := range tests {
+		dst := solidImage(2, 2, backdrop)
+		DrawBlend(dst, dst.Bounds(), solidImage(2, 2, source), image.Point{}, nil, image.Point{}, tt.mode)
+		if got := dst.RGBAAt(0, 0); !near(got, tt.want) {
+			t.Errorf("%s = %v; expected %v", tt.mode, got, tt.want)
+		}
+	}
+
+	// normal and unknown modes draw over
+	for _, mode := range []BlendMode{"", BlendNormal, "hue"} {
+		dst := solidImage(2, 2, backdrop)
+		DrawBlend(dst, dst.Bounds(), solidImage(2, 2, source), image.Point{}, nil, image.Point{}, mode)
+		if got := dst.RGBAAt(0, 0); got != source {
+			t.Errorf("%q = %v; expected the source", mode, got)
+		}
+	}
+}
+
+func Test_DrawBlend_MaskAndAlpha(t *testing.T) {
+	backdrop := color.RGBA{200, 100, 50, 255}
+	src := solidImage(2, 1, color.RGBA{100, 100, 200, 255})
+	mask := image.NewAlpha(image.Rect(0, 0, 2, 1))
+	mask.Pix[0], mask.Pix[1] = 0, 128
+
+	dst := solidImage(2, 1, backdrop)
+	DrawBlend(dst, dst.Bounds(), src, image.Point{}, mask, image.Point{}, BlendMultiply)
+	if got := dst.RGBAAt(0, 0); got != backdrop {
+		t.Errorf("masked out pixel = %v; expected the backdrop", got)
+	}
+	// half the mask gives half the multiplied color
+	if got := dst.RGBAAt(1, 0); got.R < 137 || got.R > 141 || got.A != 255 {
+		t.Errorf("half masked pixel = %v; expected halfway to the multiplied color", got)
+	}
+
+	// over a transparent backdrop every mode draws the source as is
+	dst = image.NewRGBA(image.Rect(0, 0, 2, 1))
+	DrawBlend(dst, dst.Bounds(), src, image.Point{}, nil, image.Point{}, BlendDifference)
+	if got := dst.RGBAAt(0, 0); got != src.RGBAAt(0, 0) {
+		t.Errorf("source over transparency = %v; expected %v", got, src.RGBAAt(0, 0))
+	}
+
+	// normal is draw.Over
+	want := solidImage(2, 1, backdrop)
+	draw.DrawMask(want, want.Bounds(), src, image.Point{}, mask, image.Point{}, draw.Over)
+	dst = solidImage(2, 1, backdrop)
+	DrawBlend(dst, dst.Bounds(), src, image.Point{}, mask, image.Point{}, BlendNormal)
+	if !bytes.Equal(dst.Pix, want.Pix) {
+		t.Errorf("normal blend = %v; expected %v", dst.Pix, want.Pix)
+	}
+}
+
+func Test_Render_BlendMode(t *testing.T) {
+	base := solidImage(20, 20, color.RGBA{200, 100, 50, 255})
+	loader := func(path string) (image.Image, error) {
+		return solidImage(10, 10, color.RGBA{255, 255, 255, 255}), nil
+	}
+	render := func(slot Slot) *image.RGBA {
+		slot.ID, slot.Width, slot.Height = "wash", 10, 10
+		img, _, err := Render(context.Background(), &Template{Slots: []Slot{slot}}, Inputs{"wash": "white.png"},
+			WithBaseImage(base), WithImageLoader(loader))
+		if err != nil {
+			t.Fatalf("Render returned error: %v", err)
+		}
+		return img.(*image.RGBA)
+	}
+	// white multiplied leaves the base as it is
+	if got := render(Slot{BlendMode: BlendMultiply}).RGBAAt(5, 5); got != (color.RGBA{200, 100, 50, 255}) {
+		t.Errorf("multiplied white = %v; expected the base", got)
+	}
+	// difference with white inverts, also after a rotation and at half opacity
+	got := render(Slot{X: 5, Y: 5, AnchorX: Float(0.5), AnchorY: Float(0.5), Rotation: 45, BlendMode: BlendDifference, Opacity: Float(0.5)}).RGBAAt(5, 5)
+	if got.R < 125 || got.R > 130 || got.B < 125 || got.B > 155 {
+		t.Errorf("half difference with white = %v; expected halfway to the inverted base", got)
+	}
+}
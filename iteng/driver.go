@@ -15,98 +15,37 @@
 package iteng
 
 import (
+	"context"
 	"fmt"
-	"image"
-	"image/draw"
-	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/fogleman/gg"
+	"time"
 )
 
-func ImageDriver(templatePath string, inputsPath string, outputPath string) error {
+// ImageDriver reads the template and inputs files, renders them and
+// saves the result to outputPath. Pass WithStrict() to fail rather than
+// produce degraded output.
+func ImageDriver(templatePath string, inputsPath string, outputPath string, opts ...Option) error {
+	_, err := ImageDriverContext(context.Background(), templatePath, inputsPath, outputPath, opts...)
+	return err
+}
+
+// ImageDriverContext is ImageDriver bounded by ctx that also returns the render Report.
+// It returns ctx.Err() if ctx is cancelled or its deadline passes while rendering.
+func ImageDriverContext(ctx context.Context, templatePath string, inputsPath string, outputPath string, opts ...Option) (*Report, error) {
 	tmpl, err := ParseTemplate(templatePath)
 	if err != nil {
-		return fmt.Errorf("parsing template: %v", err)
+		return nil, fmt.Errorf("parsing template: %v", err)
 	}
 
 	inputs, err := ParseInputs(inputsPath)
 	if err != nil {
-		return fmt.Errorf("parsing inputs: %v", err)
+		return nil, fmt.Errorf("parsing inputs: %v", err)
 	}
 
-	baseImg, err := LoadImageFromFile(tmpl.TemplateImage)
+	canvas, report, err := Render(ctx, tmpl, inputs, opts...)
 	if err != nil {
-		return fmt.Errorf("loading base image: %v", err)
-	}
-
-	var canvas *image.RGBA
-	if tmpl.Output.Width > 0 && tmpl.Output.Height > 0 {
-		canvas = image.NewRGBA(image.Rect(0, 0, tmpl.Output.Width, tmpl.Output.Height))
-		// draw scaled base to fill canvas
-		scaledBase := ResizeImage(baseImg, tmpl.Output.Width, tmpl.Output.Height, ResizeModeFill)
-		draw.Draw(canvas, canvas.Bounds(), scaledBase, image.Point{0, 0}, draw.Src)
-	} else {
-		b := baseImg.Bounds()
-		canvas = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
-		draw.Draw(canvas, canvas.Bounds(), baseImg, b.Min, draw.Src)
-	}
-
-	dc := gg.NewContextForRGBA(canvas)
-
-	// Process slots
-	for _, slot := range tmpl.Slots {
-		val, ok := inputs[slot.ID]
-		if !ok {
-			continue
-		}
-
-		if slot.IsText {
-			// draw text in slot
-			slot.DrawTextInto(dc, val)
-			continue
-		}
-
-		// load image
-		imgPath := val
-		img, err := LoadImageFromFile(imgPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to load image for slot %s: %v", slot.ID, err)
-			continue
-		}
-
-		mode := slot.Mode
-		if mode == "" {
-			mode = ResizeModeFit
-		}
-
-		resized := ResizeImage(img, slot.Width, slot.Height, mode)
-		// apply opacity
-		finalImg := ApplyOpacity(resized, slot.Opacity)
-
-		// If mask requested, create mask and use draw.DrawMask
-		mask := MakeMask(slot.Mask, finalImg.Bounds().Dx(), finalImg.Bounds().Dy(), slot.Radius)
-
-		// compute anchor placement
-		ax := slot.AnchorX
-		ay := slot.AnchorY
-		if ax < 0 || ax > 1 {
-			ax = 0
-		}
-		if ay < 0 || ay > 1 {
-			ay = 0
-		}
-		ox := slot.X - int(float64(finalImg.Bounds().Dx())*ax)
-		oy := slot.Y - int(float64(finalImg.Bounds().Dy())*ay)
-		dstRect := image.Rect(ox, oy, ox+finalImg.Bounds().Dx(), oy+finalImg.Bounds().Dy())
-
-		// prepare RGBA overlay
-		rgbaOverlay := image.NewRGBA(finalImg.Bounds())
-		draw.Draw(rgbaOverlay, rgbaOverlay.Bounds(), finalImg, finalImg.Bounds().Min, draw.Src)
-
-		// draw with mask
-		draw.DrawMask(canvas, dstRect, rgbaOverlay, image.Point{0, 0}, mask, image.Point{0, 0}, draw.Over)
+		return report, err
 	}
 
 	// Save output
@@ -120,12 +59,15 @@ func ImageDriver(templatePath string, inputsPath string, outputPath string) erro
 		}
 	}
 
-	ret := SaveImageToFile(canvas, outputPath, outFormat)
+	encStart := time.Now()
+	ret := saveImageToFile(ctx, canvas, outputPath, outFormat)
+	report.Encode = time.Since(encStart)
+	report.Total += report.Encode
 	if ret != nil {
-		return fmt.Errorf("saving output image: %v", ret)
+		return report, fmt.Errorf("saving output image: %v", ret)
 	}
 
 	//log.Printf("Generated image saved to: %s", outputPath)
 
-	return nil
+	return report, nil
 }
@@ -0,0 +1,284 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// Filter types for Filter.Type
+// blur - gaussian blur of Radius px
+// grayscale - remove the color, Amount 0..1
+// sepia - brown tones of old photographs, Amount 0..1
+// brightness - multiply the colors by Amount, 1 keeps them
+// contrast - scale the colors away from mid gray by Amount, 1 keeps them
+// saturation - scale the color saturation by Amount, 1 keeps it
+// hue_rotate - turn the hues by Angle degrees
+// invert - invert the colors, Amount 0..1
+// sharpen - unsharp mask of Radius px and strength Amount
+// tint - multiply the colors by Color, Amount 0..1
+const (
+	FilterBlur       = "blur"
+	FilterGrayscale  = "grayscale"
+	FilterSepia      = "sepia"
+	FilterBrightness = "brightness"
+	FilterContrast   = "contrast"
+	FilterSaturation = "saturation"
+	FilterHueRotate  = "hue_rotate"
+	FilterInvert     = "invert"
+	FilterSharpen    = "sharpen"
+	FilterTint       = "tint"
+)
+
+// defaultSharpenRadius is the Radius of sharpen filters that omit it
+const defaultSharpenRadius = 1
+
+// ApplyFilters runs filters over img in order. Unknown filter types are
+// skipped, Validate reports them.
+func ApplyFilters(img image.Image, filters []Filter) image.Image {
+	img, _ = applyFiltersContext(context.Background(), img, filters)
+	return img
+}
+
+// applyFiltersContext is ApplyFilters that returns ctx.Err() between filters once ctx is done
+func applyFiltersContext(ctx context.Context, img image.Image, filters []Filter) (image.Image, error) {
+	for _, f := range filters {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		img = f.Apply(img)
+	}
+	return img, nil
+}
+
+// Apply returns img with the filter applied, or img itself for an unknown filter type
+func (f Filter) Apply(img image.Image) image.Image {
+	amount := f.EffectiveAmount()
+	switch strings.ToLower(f.Type) {
+	case FilterBlur:
+		return GaussianBlur(img, f.Radius)
+	case FilterGrayscale:
+		return Grayscale(img, amount)
+	case FilterSepia:
+		return Sepia(img, amount)
+	case FilterBrightness:
+		return Brightness(img, amount)
+	case FilterContrast:
+		return Contrast(img, amount)
+	case FilterSaturation:
+		return Saturation(img, amount)
+	case FilterHueRotate:
+		return HueRotate(img, f.Angle)
+	case FilterInvert:
+		return Invert(img, amount)
+	case FilterSharpen:
+		radius := f.Radius
+		if radius <= 0 {
+			radius = defaultSharpenRadius
+		}
+		return Sharpen(img, amount, radius)
+	case FilterTint:
+		return Tint(img, hexColorOr(f.Color, color.White), amount)
+	}
+	return img
+}
+
+// EffectiveAmount returns the filter amount, 1 when omitted
+func (f Filter) EffectiveAmount() float64 {
+	if f.Amount == nil {
+		return 1
+	}
+	return *f.Amount
+}
+
+// GaussianBlur blurs img with a gaussian of the given radius in pixels, two
+// standard deviations as in CSS. Pixels past the edges repeat the edge.
+func GaussianBlur(img image.Image, radius float64) *image.RGBA {
+	out := toRGBA(img)
+	if radius <= 0 {
+		return out
+	}
+	blurRGBA(out, radius/2)
+	return out
+}
+
+// Sharpen sharpens img with an unsharp mask: the difference between img and
+// img blurred by radius pixels is added amount times
+func Sharpen(img image.Image, amount, radius float64) *image.RGBA {
+	out := toRGBA(img)
+	if amount <= 0 || radius <= 0 {
+		return out
+	}
+	blurred := toRGBA(out)
+	blurRGBA(blurred, radius/2)
+	for i := 0; i < len(out.Pix); i += 4 {
+		a := float64(out.Pix[i+3])
+		for c := 0; c < 3; c++ {
+			v := float64(out.Pix[i+c])
+			// premultiplied colors stay at most the alpha
+			out.Pix[i+c] = clampUint8(math.Min(a, v+amount*(v-float64(blurred.Pix[i+c]))))
+		}
+	}
+	return out
+}
+
+// Grayscale removes amount, 0..1, of the color of img
+func Grayscale(img image.Image, amount float64) *image.RGBA {
+	a := 1 - clampUnit(amount)
+	return colorMatrix(img, [9]float64{
+		0.2126 + 0.7874*a, 0.7152 - 0.7152*a, 0.0722 - 0.0722*a,
+		0.2126 - 0.2126*a, 0.7152 + 0.2848*a, 0.0722 - 0.0722*a,
+		0.2126 - 0.2126*a, 0.7152 - 0.7152*a, 0.0722 + 0.9278*a,
+	})
+}
+
+// Sepia turns amount, 0..1, of img into the brown tones of old photographs
+func Sepia(img image.Image, amount float64) *image.RGBA {
+	a := 1 - clampUnit(amount)
+	return colorMatrix(img, [9]float64{
+		0.393 + 0.607*a, 0.769 - 0.769*a, 0.189 - 0.189*a,
+		0.349 - 0.349*a, 0.686 + 0.314*a, 0.168 - 0.168*a,
+		0.272 - 0.272*a, 0.534 - 0.534*a, 0.131 + 0.869*a,
+	})
+}
+
+// Saturation scales the color saturation of img by amount, 0 for gray and 1 for no change
+func Saturation(img image.Image, amount float64) *image.RGBA {
+	s := math.Max(0, amount)
+	return colorMatrix(img, [9]float64{
+		0.213 + 0.787*s, 0.715 - 0.715*s, 0.072 - 0.072*s,
+		0.213 - 0.213*s, 0.715 + 0.285*s, 0.072 - 0.072*s,
+		0.213 - 0.213*s, 0.715 - 0.715*s, 0.072 + 0.928*s,
+	})
+}
+
+// HueRotate turns the hues of img by degrees around the color wheel
+func HueRotate(img image.Image, degrees float64) *image.RGBA {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	return colorMatrix(img, [9]float64{
+		0.213 + cos*0.787 - sin*0.213, 0.715 - cos*0.715 - sin*0.715, 0.072 - cos*0.072 + sin*0.928,
+		0.213 - cos*0.213 + sin*0.143, 0.715 + cos*0.285 + sin*0.140, 0.072 - cos*0.072 - sin*0.283,
+		0.213 - cos*0.213 - sin*0.787, 0.715 - cos*0.715 + sin*0.715, 0.072 + cos*0.928 + sin*0.072,
+	})
+}
+
+// Brightness multiplies the colors of img by amount, 1 for no change
+func Brightness(img image.Image, amount float64) *image.RGBA {
+	a := math.Max(0, amount)
+	return mapColors(img, func(c float64) float64 { return c * a })
+}
+
+// Contrast scales the colors of img away from mid gray by amount, 0 for
+// gray and 1 for no change
+func Contrast(img image.Image, amount float64) *image.RGBA {
+	a := math.Max(0, amount)
+	return mapColors(img, func(c float64) float64 { return (c-0.5)*a + 0.5 })
+}
+
+// Invert inverts amount, 0..1, of the colors of img
+func Invert(img image.Image, amount float64) *image.RGBA {
+	a := clampUnit(amount)
+	return mapColors(img, func(c float64) float64 { return c*(1-a) + (1-c)*a })
+}
+
+// Tint multiplies the colors of img by c, mixed in by amount, 0..1.
+// White becomes c and black stays black.
+func Tint(img image.Image, c color.Color, amount float64) *image.RGBA {
+	a := clampUnit(amount)
+	t := color.NRGBAModel.Convert(c).(color.NRGBA)
+	mul := [3]float64{float64(t.R) / 255, float64(t.G) / 255, float64(t.B) / 255}
+	return mapPixels(img, func(rgb [3]float64) [3]float64 {
+		for i := range rgb {
+			rgb[i] *= 1 - a + a*mul[i]
+		}
+		return rgb
+	})
+}
+
+// colorMatrix multiplies the colors of img by the row major 3x3 matrix m
+func colorMatrix(img image.Image, m [9]float64) *image.RGBA {
+	return mapPixels(img, func(c [3]float64) [3]float64 {
+		return [3]float64{
+			m[0]*c[0] + m[1]*c[1] + m[2]*c[2],
+			m[3]*c[0] + m[4]*c[1] + m[5]*c[2],
+			m[6]*c[0] + m[7]*c[1] + m[8]*c[2],
+		}
+	})
+}
+
+// mapColors applies f to every color channel of img
+func mapColors(img image.Image, f func(c float64) float64) *image.RGBA {
+	return mapPixels(img, func(c [3]float64) [3]float64 {
+		return [3]float64{f(c[0]), f(c[1]), f(c[2])}
+	})
+}
+
+// mapPixels applies f to the unpremultiplied colors of img, from 0 to 1,
+// clamping the results and keeping the alpha
+func mapPixels(img image.Image, f func(rgb [3]float64) [3]float64) *image.RGBA {
+	out := toRGBA(img)
+	for i := 0; i < len(out.Pix); i += 4 {
+		a := float64(out.Pix[i+3])
+		if a == 0 {
+			continue
+		}
+		rgb := f([3]float64{float64(out.Pix[i]) / a, float64(out.Pix[i+1]) / a, float64(out.Pix[i+2]) / a})
+		for c := 0; c < 3; c++ {
+			out.Pix[i+c] = clampUint8(clampUnit(rgb[c]) * a)
+		}
+	}
+	return out
+}
+
+// blurRGBA blurs the premultiplied channels of img in place with a gaussian
+// of standard deviation sigma, repeating the edge pixels
+func blurRGBA(img *image.RGBA, sigma float64) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	buf := make([]float64, w*h)
+	tmp := make([]float64, w*h)
+	boxes := gaussBoxes(sigma, 3)
+	for c := 0; c < 4; c++ {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				buf[y*w+x] = float64(img.Pix[y*img.Stride+x*4+c])
+			}
+		}
+		for _, size := range boxes {
+			boxBlur(buf, tmp, w, h, size/2, true)
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.Pix[y*img.Stride+x*4+c] = clampUint8(buf[y*w+x])
+			}
+		}
+	}
+}
+
+// toRGBA returns a copy of img as an *image.RGBA with the same bounds
+func toRGBA(img image.Image) *image.RGBA {
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+	return out
+}
+
+func clampUnit(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,133 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func Test_colorFilters(t *testing.T) {
+	red := solidImage(4, 4, color.RGBA{200, 40, 40, 255})
+	near := func(a, b color.RGBA) bool {
+		d := func(x, y uint8) bool { return int(x)-int(y) <= 2 && int(y)-int(x) <= 2 }
+		return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && a.A == b.A
+	}
+	tests := []struct {
+		name string
+		img  *image.RGBA
+		want color.RGBA
+	}{
+		{"grayscale", Grayscale(red, 1), color.RGBA{74, 74, 74, 255}},
+		{"grayscale none", Grayscale(red, 0), color.RGBA{200, 40, 40, 255}},
+		{"sepia", Sepia(red, 1), color.RGBA{116, 103, 80, 255}},
+		{"brightness", Brightness(red, 0.5), color.RGBA{100, 20, 20, 255}},
+		{"contrast", Contrast(red, 0), color.RGBA{128, 128, 128, 255}},
+		{"saturation", Saturation(red, 0), color.RGBA{76, 76, 76, 255}},
+		{"hue_rotate", HueRotate(red, 0), color.RGBA{200, 40, 40, 255}},
+		{"invert", Invert(red, 1), color.RGBA{55, 215, 215, 255}},
+		{"tint", Tint(red, color.RGBA{0, 0, 255, 255}, 1), color.RGBA{0, 0, 40, 255}},
+		{"tint half", Tint(solidImage(4, 4, color.RGBA{255, 255, 255, 255}), color.RGBA{255, 0, 0, 255}, 0.5), color.RGBA{255, 128, 128, 255}},
+	}
+	for _, tt := range tests {
+		if got := tt.img.RGBAAt(1, 1); !near(got, tt.want) {
+			t.Errorf("%s = %v; expected %v", tt.name, got, tt.want)
+		}
+	}
+
+	// a turn of the hue by a third makes red green
+	if c := HueRotate(solidImage(1, 1, color.RGBA{255, 0, 0, 255}), 120).RGBAAt(0, 0); c.G < c.R || c.G < c.B {
+		t.Errorf("red turned by 120 degrees = %v; expected green", c)
+	}
+
+	// colors are filtered unpremultiplied, so translucent pixels keep their alpha and hue
+	half := solidImage(1, 1, color.RGBA{128, 0, 0, 128})
+	if c := Invert(half, 1).RGBAAt(0, 0); c.A != 128 || c.R > 2 || c.G < 125 {
+		t.Errorf("inverted translucent red = %v; expected translucent cyan", c)
+	}
+}
+
+func Test_GaussianBlur(t *testing.T) {
+	img := halvesImage(20, 10)
+	blurred := GaussianBlur(img, 4)
+	// the edge between the halves is smoothed
+	if c := blurred.RGBAAt(9, 5); c.R == 255 || c.G == 0 {
+		t.Errorf("pixel beside the edge = %v; expected red and green mixed", c)
+	}
+	// the image edges repeat, so far pixels and the alpha are unchanged
+	if c := blurred.RGBAAt(0, 0); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("corner = %v; expected it unchanged", c)
+	}
+	if c := GaussianBlur(img, 0).RGBAAt(9, 5); c != img.RGBAAt(9, 5) {
+		t.Errorf("blur of radius 0 changed %v to %v", img.RGBAAt(9, 5), c)
+	}
+}
+
+func Test_Sharpen(t *testing.T) {
+	img := solidImage(10, 1, color.RGBA{100, 100, 100, 255})
+	for x := 5; x < 10; x++ {
+		img.SetRGBA(x, 0, color.RGBA{150, 150, 150, 255})
+	}
+	sharp := Sharpen(img, 1, 2)
+	// the edge gets darker on the dark side and lighter on the light side
+	if d, l := sharp.RGBAAt(4, 0), sharp.RGBAAt(5, 0); d.R >= 100 || l.R <= 150 {
+		t.Errorf("edge = %v, %v; expected more contrast than 100, 150", d, l)
+	}
+	if c := sharp.RGBAAt(0, 0); c.R != 100 {
+		t.Errorf("flat area = %v; expected it unchanged", c)
+	}
+}
+
+func Test_ApplyFilters(t *testing.T) {
+	img := solidImage(2, 2, color.RGBA{200, 40, 40, 255})
+	// filters run in order, so the gray is brightened
+	out := ApplyFilters(img, []Filter{{Type: "grayscale"}, {Type: FilterBrightness, Amount: Float(2)}})
+	if r, g, _, _ := out.At(0, 0).RGBA(); r>>8 < 140 || r != g {
+		t.Errorf("filtered pixel r=%d g=%d; expected a bright gray", r>>8, g>>8)
+	}
+	if ApplyFilters(img, []Filter{{Type: "emboss"}}) != image.Image(img) {
+		t.Errorf("an unknown filter changed the image")
+	}
+}
+
+func Test_Render_Filters(t *testing.T) {
+	base := solidImage(20, 20, color.RGBA{0, 0, 255, 255})
+	loader := func(path string) (image.Image, error) {
+		return solidImage(10, 10, color.RGBA{255, 0, 0, 255}), nil
+	}
+	tmpl := &Template{
+		Filters: []Filter{{Type: FilterInvert}},
+		Slots: []Slot{{ID: "logo", Width: 10, Height: 10, Mask: "circle",
+			Filters: []Filter{{Type: FilterGrayscale}}}},
+	}
+	img, _, err := Render(context.Background(), tmpl, Inputs{"logo": "logo.png"}, WithBaseImage(base), WithImageLoader(loader))
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	rgba := img.(*image.RGBA)
+	// the base is inverted to yellow, the slot is gray inside its mask
+	if c := rgba.RGBAAt(15, 15); c != (color.RGBA{255, 255, 0, 255}) {
+		t.Errorf("base pixel = %v; expected inverted blue", c)
+	}
+	if c := rgba.RGBAAt(5, 5); c.R != c.G || c.G != c.B {
+		t.Errorf("slot pixel = %v; expected gray", c)
+	}
+	// the mask is applied after the filters
+	if c := rgba.RGBAAt(0, 0); c != (color.RGBA{255, 255, 0, 255}) {
+		t.Errorf("masked corner = %v; expected the base", c)
+	}
+}
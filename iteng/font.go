@@ -0,0 +1,583 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	gtfont "github.com/go-text/typesetting/font"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// defaultFontSize is used when a text slot has no font_size, as gg did
+const defaultFontSize = 12
+
+// DefaultFont is the name of the font compiled into the package, the Go Regular font.
+// It is used when a text slot's font cannot be found. Register another font
+// under this name to replace it.
+const DefaultFont = "Go Regular"
+
+// FontRegistry parses each font once and caches its faces per size.
+// It is safe for concurrent use, so one registry can be shared by
+// every slot and every render in a process.
+//
+// Fonts registered by name can be used from a template with font_name.
+// Fonts loaded by path, URL or system name are cached under keys like
+// "file:fonts/title.ttf", "url:https://..." and "system:Arial".
+// A font that fails to load is not tried again under the same key, call
+// ClearFailures to retry it, e.g. after installing a missing font.
+type FontRegistry struct {
+	mu    sync.RWMutex
+	data  map[string][]byte
+	fonts map[string]*opentype.Font
+	faces map[faceKey]font.Face
+	// shaping holds the fonts parsed for TextShapingOpenType on first use
+	shaping map[string]*gtfont.Font
+	// failed holds the errors of fonts that could not be loaded
+	failed map[string]error
+}
+
+type faceKey struct {
+	name string
+	size float64
+}
+
+// NewFontRegistry returns an empty FontRegistry
+func NewFontRegistry() *FontRegistry {
+	return &FontRegistry{
+		data:    make(map[string][]byte),
+		fonts:   make(map[string]*opentype.Font),
+		faces:   make(map[faceKey]font.Face),
+		shaping: make(map[string]*gtfont.Font),
+		failed:  make(map[string]error),
+	}
+}
+
+// DefaultFontRegistry is used by DrawTextInto, and by Render unless
+// WithFontRegistry is given
+var DefaultFontRegistry = NewFontRegistry()
+
+// Register parses TrueType or OpenType font data and registers it under name,
+// replacing any font already registered under that name
+func (r *FontRegistry) Register(name string, data []byte) error {
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return fmt.Errorf("parsing font %s: %v", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[name] = data
+	r.fonts[name] = f
+	delete(r.shaping, name)
+	delete(r.failed, name)
+	for key := range r.faces {
+		if key.name == name {
+			delete(r.faces, key)
+		}
+	}
+	return nil
+}
+
+// RegisterFile reads the font file at path and registers it under name
+func (r *FontRegistry) RegisterFile(name, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return r.Register(name, data)
+}
+
+// RegisterFS reads the font file at path in fsys and registers it under name.
+// Use it with an embed.FS to register fonts compiled into the binary.
+func (r *FontRegistry) RegisterFS(name string, fsys fs.FS, path string) error {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return err
+	}
+	return r.Register(name, data)
+}
+
+// Has reports whether a font is registered under name
+func (r *FontRegistry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.fonts[name]
+	return ok
+}
+
+// Face returns a face of the named font at size points.
+// Faces are cached and may be used from several goroutines at once.
+func (r *FontRegistry) Face(name string, size float64) (font.Face, error) {
+	if size <= 0 {
+		size = defaultFontSize
+	}
+	key := faceKey{name: name, size: size}
+
+	r.mu.RLock()
+	face, ok := r.faces[key]
+	f := r.fonts[name]
+	r.mu.RUnlock()
+	if ok {
+		return face, nil
+	}
+	if f == nil {
+		return nil, fmt.Errorf("font %s is not registered", name)
+	}
+
+	ot, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingNone,
+	})
+	if err != nil {
+		return nil, err
+	}
+	face = &lockedFace{face: ot, font: f}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cached, ok := r.faces[key]; ok {
+		return cached, nil
+	}
+	r.faces[key] = face
+	return face, nil
+}
+
+// shapingFont returns the font registered under name parsed for the shaper,
+// and the font its glyph outlines are drawn from
+func (r *FontRegistry) shapingFont(name string) (*gtfont.Font, *opentype.Font, error) {
+	r.mu.RLock()
+	f, ok := r.shaping[name]
+	outlines := r.fonts[name]
+	data := r.data[name]
+	r.mu.RUnlock()
+	if ok {
+		return f, outlines, nil
+	}
+	if outlines == nil {
+		return nil, nil, fmt.Errorf("font %s is not registered", name)
+	}
+
+	face, err := gtfont.ParseTTF(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing font %s for shaping: %v", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shaping[name] = face.Font
+	return face.Font, outlines, nil
+}
+
+// ClearFailures forgets the fonts that failed to load, so the next
+// text slot using one of them tries to load it again
+func (r *FontRegistry) ClearFailures() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.failed)
+}
+
+// load registers the font under key on first use, reading it with fetch.
+// Failures are remembered unless ctx ended the fetch, which says nothing
+// about the font.
+func (r *FontRegistry) load(ctx context.Context, key string, fetch func() ([]byte, error)) error {
+	r.mu.RLock()
+	_, ok := r.fonts[key]
+	failure := r.failed[key]
+	r.mu.RUnlock()
+	if ok {
+		return nil
+	}
+	if failure != nil {
+		return failure
+	}
+
+	data, err := fetch()
+	if err == nil {
+		err = r.Register(key, data)
+	}
+	if err != nil && ctx.Err() == nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		r.mu.Lock()
+		r.failed[key] = err
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// lockedFace serializes access to a face, which is not safe for concurrent use
+type lockedFace struct {
+	mu   sync.Mutex
+	face font.Face
+	font *opentype.Font
+	buf  sfnt.Buffer
+}
+
+// HasGlyph reports whether the font maps r to a glyph other than .notdef
+func (l *lockedFace) HasGlyph(r rune) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	idx, err := l.font.GlyphIndex(&l.buf, r)
+	return err == nil && idx != 0
+}
+
+func (l *lockedFace) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.face.Close()
+}
+
+func (l *lockedFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	dr, mask, maskp, advance, ok := l.face.Glyph(dot, r)
+	// the mask is the face's scratch buffer, copy it before another caller reuses it
+	if a, isAlpha := mask.(*image.Alpha); isAlpha {
+		c := image.NewAlpha(a.Rect)
+		copy(c.Pix, a.Pix)
+		mask = c
+	}
+	return dr, mask, maskp, advance, ok
+}
+
+func (l *lockedFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.face.GlyphBounds(r)
+}
+
+func (l *lockedFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.face.GlyphAdvance(r)
+}
+
+func (l *lockedFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.face.Kern(r0, r1)
+}
+
+func (l *lockedFace) Metrics() font.Metrics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.face.Metrics()
+}
+
+// loadFontFromURL downloads a font from a URL and returns the font bytes
+// The download is abandoned when ctx is done
+func loadFontFromURL(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading font: %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// loadFontFromSystem attempts to load a system font by name
+// Tries common system font directories for the given font name
+func loadFontFromSystem(fontName string) ([]byte, error) {
+	// Common system font directories
+	fontDirs := []string{
+		"/usr/share/fonts/truetype",     // Linux : ex: /usr/share/fonts/truetype/dejavu/DejaVuSans.ttf
+		"/System/Library/Fonts",         // macOS
+		"/Library/Fonts",                // macOS
+		"C:\\Windows\\Fonts",            // Windows
+		os.ExpandEnv("$WINDIR\\Fonts"),  // Windows via env var
+		os.ExpandEnv("$ITENG_FONT_DIR"), // Custom font dir via env var
+	}
+
+	// Common font file extensions
+	extensions := []string{".ttf", ".otf"}
+
+	for _, dir := range fontDirs {
+		for _, ext := range extensions {
+			fontPath := filepath.Join(dir, fontName+ext)
+			if data, err := os.ReadFile(fontPath); err == nil {
+				return data, nil
+			}
+
+			// Try with different case variations on case-insensitive systems
+			fontPath = filepath.Join(dir, strings.ToLower(fontName)+ext)
+			if data, err := os.ReadFile(fontPath); err == nil {
+				return data, nil
+			}
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// fontCandidate is one place a text slot's font may come from
+type fontCandidate struct {
+	key   string
+	fetch func() ([]byte, error)
+	desc  string
+}
+
+func fileFont(path string) fontCandidate {
+	return fontCandidate{
+		key:   "file:" + path,
+		fetch: func() ([]byte, error) { return os.ReadFile(path) },
+		desc:  "font from file " + path,
+	}
+}
+
+func urlFont(ctx context.Context, url string) fontCandidate {
+	return fontCandidate{
+		key:   "url:" + url,
+		fetch: func() ([]byte, error) { return loadFontFromURL(ctx, url) },
+		desc:  "font from URL " + url,
+	}
+}
+
+func systemFont(name string) fontCandidate {
+	return fontCandidate{
+		key:   "system:" + name,
+		fetch: func() ([]byte, error) { return loadFontFromSystem(name) },
+		desc:  "system font " + name,
+	}
+}
+
+// registeredFont is a font registered by name, such as an embedded font.
+// DefaultFont is registered on first use.
+func registeredFont(name string) fontCandidate {
+	return fontCandidate{
+		key: name,
+		fetch: func() ([]byte, error) {
+			if name == DefaultFont {
+				return goregular.TTF, nil
+			}
+			return nil, fmt.Errorf("not registered")
+		},
+		desc: "registered font " + name,
+	}
+}
+
+// fontCandidates lists where to look for a font, in the
+// priority order described on DrawTextInto
+func (r *FontRegistry) fontCandidates(ctx context.Context, ref FontRef) []fontCandidate {
+	var cands []fontCandidate
+
+	// Try explicit source first
+	switch strings.ToLower(ref.Source) {
+	case "url":
+		if ref.URL != "" {
+			cands = append(cands, urlFont(ctx, ref.URL))
+		}
+	case "system":
+		if ref.Name != "" {
+			cands = append(cands, systemFont(ref.Name))
+		}
+	case "file":
+		if ref.Path != "" {
+			cands = append(cands, fileFont(ref.Path))
+		}
+	case "embedded":
+		if ref.Name != "" {
+			cands = append(cands, registeredFont(ref.Name))
+		}
+	}
+
+	// then automatic discovery
+	if ref.Path != "" {
+		cands = append(cands, fileFont(ref.Path))
+	}
+	if ref.URL != "" {
+		cands = append(cands, urlFont(ctx, ref.URL))
+	}
+	if ref.Name != "" {
+		if r.Has(ref.Name) {
+			cands = append(cands, registeredFont(ref.Name))
+		}
+		cands = append(cands, systemFont(ref.Name))
+	}
+	return cands
+}
+
+// resolveTextFonts finds the fonts for the text options, following the
+// priority described on DrawTextInto. The chain is empty when no font
+// could be loaded and gg's builtin face has to be used.
+func (r *FontRegistry) resolveTextFonts(ctx context.Context, opts TextOpt) (TextResult, fontChain) {
+	var res TextResult
+	chain := fontChain{registry: r}
+
+	add := func(cands []fontCandidate) {
+		key, err := r.firstFont(ctx, cands)
+		if err != nil && res.FontErr == nil {
+			res.FontErr = err
+		}
+		if key == "" {
+			return
+		}
+		for _, k := range chain.keys {
+			if k == key {
+				return
+			}
+		}
+		chain.keys = append(chain.keys, key)
+	}
+
+	primary := r.fontCandidates(ctx, opts.primaryFont())
+	if ttfFile := os.Getenv("ITENG_FONT_TTF"); ttfFile != "" {
+		primary = append(primary, fileFont(filepath.Join(os.Getenv("ITENG_FONT_DIR"), ttfFile)))
+	}
+	add(primary)
+	for _, ref := range opts.Fonts {
+		add(r.fontCandidates(ctx, ref))
+	}
+	add([]fontCandidate{registeredFont(DefaultFont)})
+
+	res.Fonts = chain.keys
+	res.FontSize = opts.FontSize
+	if res.FontSize <= 0 {
+		res.FontSize = defaultFontSize
+	}
+	if len(chain.keys) == 0 {
+		res.Font = "builtin"
+		res.FontFallback = true
+		if res.FontErr == nil {
+			res.FontErr = fmt.Errorf("no font could be loaded")
+		}
+		return res, chain
+	}
+
+	res.Font = res.Fonts[0]
+	// the default font is only a fallback when another font was requested
+	res.FontFallback = res.FontErr != nil
+	return res, chain
+}
+
+// fontChain is a list of loaded registry fonts, in fallback order
+type fontChain struct {
+	registry *FontRegistry
+	keys     []string
+}
+
+// face returns a face of the given size that draws each rune with the first
+// font of the chain that has a glyph for it, or nil for an empty chain
+func (c fontChain) face(size float64) font.Face {
+	var faces []font.Face
+	for _, key := range c.keys {
+		if face, err := c.registry.Face(key, size); err == nil {
+			faces = append(faces, face)
+		}
+	}
+	switch len(faces) {
+	case 0:
+		return nil
+	case 1:
+		return faces[0]
+	}
+	return &fallbackFace{faces: faces}
+}
+
+// firstFont loads the first candidate that loads and returns its key.
+// It returns an empty key and error when there are no candidates.
+func (r *FontRegistry) firstFont(ctx context.Context, cands []fontCandidate) (string, error) {
+	var firstErr error
+	tried := make(map[string]bool)
+	for _, cand := range cands {
+		if tried[cand.key] {
+			continue
+		}
+		tried[cand.key] = true
+
+		err := r.load(ctx, cand.key, cand.fetch)
+		if err == nil {
+			return cand.key, firstErr
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("failed to load %s: %v", cand.desc, err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", firstErr
+}
+
+// glyphChecker is a face that can tell whether it has a glyph for a rune
+type glyphChecker interface {
+	HasGlyph(r rune) bool
+}
+
+// fallbackFace draws each rune with the first face that has a glyph for it,
+// or with the first face when none has. Metrics come from the first face.
+type fallbackFace struct {
+	faces []font.Face
+}
+
+func (f *fallbackFace) faceFor(r rune) font.Face {
+	for _, face := range f.faces {
+		if gc, ok := face.(glyphChecker); ok && gc.HasGlyph(r) {
+			return face
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faceFor(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faceFor(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.faceFor(r).GlyphAdvance(r)
+}
+
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.faceFor(r0)
+	if face != f.faceFor(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
@@ -0,0 +1,314 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+func Test_FontRegistry_Register(t *testing.T) {
+	r := NewFontRegistry()
+
+	if err := r.RegisterFile("phoenician", "../test/NotoSansPhoenician-Regular.ttf"); err != nil {
+		t.Errorf("RegisterFile returned error: %v", err)
+	}
+	if err := r.RegisterFS("tagalog", os.DirFS("../test"), "NotoSansTagalog-Regular.ttf"); err != nil {
+		t.Errorf("RegisterFS returned error: %v", err)
+	}
+	data, err := os.ReadFile("../test/NotoSansPhoenician-Regular.ttf")
+	if err != nil {
+		t.Fatalf("reading font: %v", err)
+	}
+	if err := r.Register("bytes", data); err != nil {
+		t.Errorf("Register returned error: %v", err)
+	}
+
+	for _, name := range []string{"phoenician", "tagalog", "bytes"} {
+		if !r.Has(name) {
+			t.Errorf("font %s should be registered", name)
+		}
+	}
+
+	if err := r.Register("bad", []byte("not a font")); err == nil {
+		t.Errorf("Register should fail for invalid font data")
+	}
+	if err := r.RegisterFile("missing", "non-existant-font.ttf"); err == nil {
+		t.Errorf("RegisterFile should fail for a missing file")
+	}
+}
+
+func Test_FontRegistry_FaceCache(t *testing.T) {
+	r := NewFontRegistry()
+	if err := r.RegisterFile("tagalog", "../test/NotoSansTagalog-Regular.ttf"); err != nil {
+		t.Fatalf("RegisterFile returned error: %v", err)
+	}
+
+	f1, err := r.Face("tagalog", 20)
+	if err != nil {
+		t.Fatalf("Face returned error: %v", err)
+	}
+	f2, _ := r.Face("tagalog", 20)
+	if f1 != f2 {
+		t.Errorf("Face should return the cached face for the same size")
+	}
+	f3, _ := r.Face("tagalog", 30)
+	if f1 == f3 {
+		t.Errorf("Face should return a different face for a different size")
+	}
+	if h20, h30 := f1.Metrics().Height, f3.Metrics().Height; h30 <= h20 {
+		t.Errorf("30pt face height %v should exceed 20pt face height %v", h30, h20)
+	}
+
+	if _, err := r.Face("unknown", 20); err == nil {
+		t.Errorf("Face should fail for an unregistered font")
+	}
+}
+
+func Test_FontRegistry_ConcurrentDraw(t *testing.T) {
+	r := NewFontRegistry()
+	slot := Slot{
+		X: 0, Y: 0, Width: 200, Height: 50,
+		TextOpts: TextOpt{FontSource: "file", FontPath: "../test/NotoSansTagalog-Regular.ttf", FontSize: 18},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dc := gg.NewContext(200, 50)
+			res, err := slot.drawText(context.Background(), dc, r, "Concurrent text")
+			if err != nil || res.FontFallback {
+				t.Errorf("drawText = %+v, %v", res, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_FontRegistry_CachesFileFonts(t *testing.T) {
+	data, err := os.ReadFile("../test/NotoSansPhoenician-Regular.ttf")
+	if err != nil {
+		t.Fatalf("reading font: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "font.ttf")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("writing font: %v", err)
+	}
+
+	r := NewFontRegistry()
+	opts := TextOpt{FontSource: "file", FontPath: path, FontSize: 16}
+
+	res, _ := r.resolveTextFonts(context.Background(), opts)
+	if res.Font != "file:"+path {
+		t.Fatalf("first load resolved font %q; expected file:%s", res.Font, path)
+	}
+
+	// the parsed font is reused without reading the file again
+	os.Remove(path)
+	res, _ = r.resolveTextFonts(context.Background(), opts)
+	if res.Font != "file:"+path || res.FontFallback {
+		t.Errorf("second load resolved font %q fallback=%v; expected the cached font", res.Font, res.FontFallback)
+	}
+}
+
+func Test_FontRegistry_CachesFailures(t *testing.T) {
+	data, err := os.ReadFile("../test/NotoSansPhoenician-Regular.ttf")
+	if err != nil {
+		t.Fatalf("reading font: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "font.ttf")
+
+	r := NewFontRegistry()
+	opts := TextOpt{FontSource: "file", FontPath: path, FontSize: 16}
+	if res, _ := r.resolveTextFonts(context.Background(), opts); res.Font == "file:"+path {
+		t.Fatalf("missing font file resolved to %q", res.Font)
+	}
+
+	// the failure is remembered until it is cleared
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("writing font: %v", err)
+	}
+	if res, _ := r.resolveTextFonts(context.Background(), opts); res.Font == "file:"+path {
+		t.Errorf("failed font was loaded again before ClearFailures")
+	}
+	r.ClearFailures()
+	if res, _ := r.resolveTextFonts(context.Background(), opts); res.Font != "file:"+path {
+		t.Errorf("after ClearFailures resolved font %q; expected file:%s", res.Font, path)
+	}
+}
+
+func Test_FontRegistry_CachesURLFailures(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, nil)
+	}))
+	defer srv.Close()
+
+	r := NewFontRegistry()
+	opts := TextOpt{FontSource: "url", FontURL: srv.URL + "/font.ttf", FontSize: 16}
+
+	// a cancelled download is not a failure of the font
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.resolveTextFonts(ctx, opts)
+	r.resolveTextFonts(context.Background(), opts)
+	r.resolveTextFonts(context.Background(), opts)
+	if requests.Load() != 1 {
+		t.Errorf("font was requested %d times; expected once", requests.Load())
+	}
+
+	r.ClearFailures()
+	r.resolveTextFonts(context.Background(), opts)
+	if requests.Load() != 2 {
+		t.Errorf("font was requested %d times after ClearFailures; expected twice", requests.Load())
+	}
+}
+
+func Test_FontRegistry_FontName(t *testing.T) {
+	r := NewFontRegistry()
+	if err := r.RegisterFile("Brand", "../test/NotoSansPhoenician-Regular.ttf"); err != nil {
+		t.Fatalf("RegisterFile returned error: %v", err)
+	}
+
+	res, _ := r.resolveTextFonts(context.Background(), TextOpt{FontName: "Brand", FontSize: 16})
+	if res.Font != "Brand" || res.FontFallback {
+		t.Errorf("resolved font %q fallback=%v; expected the registered font", res.Font, res.FontFallback)
+	}
+}
+
+func Test_FontRegistry_Embedded(t *testing.T) {
+	r := NewFontRegistry()
+	if err := r.RegisterFS("Tagalog", os.DirFS("../test"), "NotoSansTagalog-Regular.ttf"); err != nil {
+		t.Fatalf("RegisterFS returned error: %v", err)
+	}
+
+	res, _ := r.resolveTextFonts(context.Background(), TextOpt{FontSource: "embedded", FontName: "Tagalog", FontSize: 16})
+	if res.Font != "Tagalog" || res.FontFallback {
+		t.Errorf("embedded font resolved to %q fallback=%v; expected Tagalog", res.Font, res.FontFallback)
+	}
+
+	res, _ = r.resolveTextFonts(context.Background(), TextOpt{FontSource: "embedded", FontName: "Unknown", FontSize: 16})
+	if res.Font != DefaultFont || !res.FontFallback || res.FontErr == nil {
+		t.Errorf("unknown embedded font resolved to %q fallback=%v err=%v; expected a fallback to %s", res.Font, res.FontFallback, res.FontErr, DefaultFont)
+	}
+}
+
+func Test_FontRegistry_DefaultFont(t *testing.T) {
+	r := NewFontRegistry()
+
+	// no font configured at all uses the default font at the requested size
+	res, chain := r.resolveTextFonts(context.Background(), TextOpt{FontSize: 40})
+	if res.Font != DefaultFont || res.FontFallback {
+		t.Errorf("resolved font %q fallback=%v; expected %s without fallback", res.Font, res.FontFallback, DefaultFont)
+	}
+	if face := chain.face(40); face == nil {
+		t.Errorf("default font has no face")
+	} else if h := fixedToFloat(face.Metrics().Height); h < 30 {
+		t.Errorf("default font height = %g; expected the requested 40pt size", h)
+	}
+
+	res, _ = r.resolveTextFonts(context.Background(), TextOpt{FontSource: "embedded", FontName: DefaultFont})
+	if res.Font != DefaultFont || res.FontFallback {
+		t.Errorf("explicit default font resolved to %q fallback=%v", res.Font, res.FontFallback)
+	}
+}
+
+func Test_FontRegistry_FallbackChain(t *testing.T) {
+	r := NewFontRegistry()
+	opts := TextOpt{
+		FontSource: "file",
+		FontPath:   "../test/NotoSansPhoenician-Regular.ttf",
+		FontSize:   20,
+		Fonts: []FontRef{
+			{Source: "file", Path: "../test/NotoSansTagalog-Regular.ttf"},
+		},
+	}
+
+	res, fonts := r.resolveTextFonts(context.Background(), opts)
+	if res.FontFallback {
+		t.Fatalf("fallback chain reported a font fallback: %v", res.FontErr)
+	}
+	expected := []string{"file:../test/NotoSansPhoenician-Regular.ttf", "file:../test/NotoSansTagalog-Regular.ttf", DefaultFont}
+	if len(res.Fonts) != len(expected) {
+		t.Fatalf("fallback chain = %v; expected %v", res.Fonts, expected)
+	}
+	for i := range expected {
+		if res.Fonts[i] != expected[i] {
+			t.Errorf("fallback chain[%d] = %s; expected %s", i, res.Fonts[i], expected[i])
+		}
+	}
+
+	phoenician, _ := r.Face(expected[0], 20)
+	tagalog, _ := r.Face(expected[1], 20)
+	latin, _ := r.Face(DefaultFont, 20)
+	chain, ok := fonts.face(20).(*fallbackFace)
+	if !ok {
+		t.Fatalf("fallback chain face is %T; expected a face that picks a font per rune", fonts.face(20))
+	}
+
+	tests := []struct {
+		r    rune
+		face font.Face
+	}{
+		{'\U00010900', phoenician}, // PHOENICIAN LETTER ALF
+		{'ᜀ', tagalog},             // TAGALOG LETTER A
+		{'A', latin},
+	}
+	for _, test := range tests {
+		if face := chain.faceFor(test.r); face != test.face {
+			t.Errorf("rune %U was drawn with the wrong font", test.r)
+		}
+	}
+
+	// unknown runes are drawn by the primary font
+	if face := chain.faceFor('\U0010FFFD'); face != phoenician {
+		t.Errorf("rune without a glyph should use the primary font")
+	}
+
+	// the mixed text measures the same as its parts drawn in their own fonts
+	mixed := font.MeasureString(chain, "Aᜀ")
+	parts := font.MeasureString(latin, "A") + font.MeasureString(tagalog, "ᜀ")
+	if mixed != parts {
+		t.Errorf("mixed text advance = %v; expected %v", mixed, parts)
+	}
+}
+
+func Test_FontRegistry_FallbackChainMissingFont(t *testing.T) {
+	r := NewFontRegistry()
+	opts := TextOpt{
+		FontSize: 20,
+		Fonts:    []FontRef{{Source: "file", Path: "non-existant-font.ttf"}},
+	}
+
+	res, _ := r.resolveTextFonts(context.Background(), opts)
+	if !res.FontFallback || res.FontErr == nil {
+		t.Errorf("a missing chain font should be reported as a fallback")
+	}
+	if res.Font != DefaultFont {
+		t.Errorf("resolved font %q; expected %s", res.Font, DefaultFont)
+	}
+}
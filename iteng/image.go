@@ -15,6 +15,8 @@
 package iteng
 
 import (
+	"context"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
@@ -22,10 +24,7 @@ import (
 	"image/jpeg"
 	"image/png"
 	"io"
-	"log"
-	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/fogleman/gg"
@@ -50,34 +49,108 @@ func LoadImageFromFile(path string) (image.Image, error) {
 
 // SaveImageToFile encodes and saves image to file with specified format
 func SaveImageToFile(img image.Image, outpath, format string) error {
+	return saveImageToFile(context.Background(), img, outpath, format)
+}
+
+// saveImageToFile removes the partially written file if encoding fails or ctx is done
+func saveImageToFile(ctx context.Context, img image.Image, outpath, format string) error {
 	out, err := os.Create(outpath)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
 
+	err = EncodeImageContext(ctx, out, img, format)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(outpath)
+	}
+	return err
+}
+
+// EncodeImageContext is EncodeImage that stops writing with ctx.Err() once ctx is done
+func EncodeImageContext(ctx context.Context, w io.Writer, img image.Image, format string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return EncodeImage(&contextWriter{ctx: ctx, w: w}, img, format)
+}
+
+// contextWriter fails writes once its context is done,
+// which makes the encoders give up part way through
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// EncodeImage encodes image to w with specified format
+func EncodeImage(w io.Writer, img image.Image, format string) error {
 	format = strings.ToLower(format)
 	switch format {
 	case "png":
 		enc := png.Encoder{CompressionLevel: png.BestCompression}
-		return enc.Encode(out, img)
+		return enc.Encode(w, img)
 	case "jpg", "jpeg":
-		return jpeg.Encode(out, img, &jpeg.Options{Quality: 92})
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 92})
 	case "gif":
-		return gif.Encode(out, img, nil)
+		return gif.Encode(w, img, nil)
 	case "tiff":
-		return tiff.Encode(out, img, nil)
+		return tiff.Encode(w, img, nil)
 	case "bmp":
-		return bmp.Encode(out, img)
+		return bmp.Encode(w, img)
 	default:
 		// fallback to png
 		enc := png.Encoder{CompressionLevel: png.BestCompression}
-		return enc.Encode(out, img)
+		return enc.Encode(w, img)
+	}
+}
+
+// ResizeImageContext is ResizeImage that returns ctx.Err() as soon as ctx is done.
+// The scaling itself cannot be interrupted, so an abandoned resize finishes
+// in the background and its result is dropped.
+func ResizeImageContext(ctx context.Context, src image.Image, dstW, dstH int, mode ResizeMode) (image.Image, error) {
+	return resizeContext(ctx, func() image.Image {
+		return ResizeImage(src, dstW, dstH, mode)
+	})
+}
+
+// resizeContext runs resize, returning ctx.Err() as soon as ctx is done
+func resizeContext(ctx context.Context, resize func() image.Image) (image.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan image.Image, 1)
+	go func() {
+		done <- resize()
+	}()
+
+	select {
+	case img := <-done:
+		return img, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
 // ResizeImage implements fill/fit/cover.
 func ResizeImage(src image.Image, dstW, dstH int, mode ResizeMode) image.Image {
+	return ResizeImageFocus(src, dstW, dstH, mode, 0.5, 0.5)
+}
+
+// ResizeImageFocus is ResizeImage with cover cropping around the focal point
+// fx, fy, a fraction of the source width and height. The crop is centered on
+// the focal point as far as the scaled image allows. Smart mode crops by
+// content and does not use the focal point.
+func ResizeImageFocus(src image.Image, dstW, dstH int, mode ResizeMode, fx, fy float64) image.Image {
 	if dstW <= 0 || dstH <= 0 {
 		return src
 	}
@@ -88,7 +161,7 @@ func ResizeImage(src image.Image, dstW, dstH int, mode ResizeMode) image.Image {
 		return src
 	}
 
-	switch mode {
+	switch ResizeMode(strings.ToLower(string(mode))) {
 	case ResizeModeFill:
 		// direct stretch
 		dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
@@ -107,12 +180,17 @@ func ResizeImage(src image.Image, dstW, dstH int, mode ResizeMode) image.Image {
 		nh := int(float64(srcH) * scale)
 		d := image.NewRGBA(image.Rect(0, 0, nw, nh))
 		imagedraw.CatmullRom.Scale(d, d.Bounds(), src, src.Bounds(), imagedraw.Over, nil)
-		// center-crop to dstW x dstH
-		x0 := (nw - dstW) / 2
-		y0 := (nh - dstH) / 2
+		// crop to dstW x dstH around the focal point
+		x0 := focusOffset(nw, dstW, fx)
+		y0 := focusOffset(nh, dstH, fy)
 		out := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
 		draw.Draw(out, out.Bounds(), d, image.Point{x0, y0}, draw.Src)
 		return out
+	case ResizeModeSmart:
+		// scale the most detailed crop to dstW x dstH
+		dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+		imagedraw.CatmullRom.Scale(dst, dst.Bounds(), src, SmartCrop(src, dstW, dstH), imagedraw.Over, nil)
+		return dst
 	default:
 		// default to fit
 		scale := minf(float64(dstW)/float64(srcW), float64(dstH)/float64(srcH))
@@ -124,6 +202,37 @@ func ResizeImage(src image.Image, dstW, dstH int, mode ResizeMode) image.Image {
 	}
 }
 
+// focusOffset is where a crop of length n starts in a length of size so it
+// is centered on the fraction focus of size, without leaving size
+func focusOffset(size, n int, focus float64) int {
+	off := int(focus*float64(size) - float64(n)/2)
+	if off > size-n {
+		off = size - n
+	}
+	if off < 0 {
+		off = 0
+	}
+	return off
+}
+
+// CropImage returns the part of src inside r, in pixels from the top left of src.
+// r is clipped to src, and src is returned whole when r misses it.
+func CropImage(src image.Image, r image.Rectangle) image.Image {
+	b := src.Bounds()
+	r = r.Add(b.Min).Intersect(b)
+	if r.Empty() || r == b {
+		return src
+	}
+	if sub, ok := src.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	out := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(out, out.Bounds(), src, r.Min, draw.Src)
+	return out
+}
+
 func minf(a, b float64) float64 {
 	if a < b {
 		return a
@@ -157,7 +266,29 @@ func ApplyOpacity(img image.Image, opacity float64) image.Image {
 	return rgba
 }
 
-// MakeMask returns an *image.Alpha mask for the requested shape
+// scaleAlpha multiplies every mask value by opacity
+func scaleAlpha(m *image.Alpha, opacity float64) {
+	if opacity >= 0.9999 {
+		return
+	}
+	if opacity < 0 {
+		opacity = 0
+	}
+	for i, a := range m.Pix {
+		m.Pix[i] = uint8(float64(a)*opacity + 0.5)
+	}
+}
+
+const (
+	// maskSupersample is how many samples per pixel along each axis MakeMask
+	// draws shapes with, for smooth edges at small sizes
+	maskSupersample = 4
+	// maskSupersamplePixels caps the samples of a mask, large masks take fewer per pixel
+	maskSupersamplePixels = 1 << 22
+)
+
+// MakeMask returns an *image.Alpha mask for the requested shape, with
+// supersampled anti-aliased edges
 func MakeMask(maskType string, w, h int, radius float64) *image.Alpha {
 	if maskType == "" {
 		m := image.NewAlpha(image.Rect(0, 0, w, h))
@@ -170,17 +301,22 @@ func MakeMask(maskType string, w, h int, radius float64) *image.Alpha {
 		return m
 	}
 
-	dc := gg.NewContext(w, h)
+	s := maskSupersample
+	for s > 1 && w*h*s*s > maskSupersamplePixels {
+		s--
+	}
+	dc := gg.NewContext(w*s, h*s)
 	dc.Clear()
+	dc.Scale(float64(s), float64(s))
 	dc.SetRGBA(0, 0, 0, 1)
 
-	if maskType == "circle" {
+	if strings.EqualFold(maskType, "circle") {
 		cx := float64(w) / 2
 		cy := float64(h) / 2
 		r := float64(min(w, h)) / 2
 		dc.DrawCircle(cx, cy, r)
 		dc.Fill()
-	} else if maskType == "rounded" {
+	} else if strings.EqualFold(maskType, "rounded") {
 		r := radius
 		if r <= 0 {
 			r = float64(min(w, h)) * 0.12
@@ -192,219 +328,152 @@ func MakeMask(maskType string, w, h int, radius float64) *image.Alpha {
 		dc.Fill()
 	}
 
+	// average the samples of every pixel
 	rgba := dc.Image().(*image.RGBA)
-	alpha := image.NewAlpha(rgba.Bounds())
-	for y := 0; y < rgba.Bounds().Dy(); y++ {
-		for x := 0; x < rgba.Bounds().Dx(); x++ {
-			_, _, _, a := rgba.At(x, y).RGBA()
-			alpha.SetAlpha(x, y, color.Alpha{uint8(a >> 8)})
+	alpha := image.NewAlpha(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sum := 0
+			for sy := y * s; sy < (y+1)*s; sy++ {
+				for sx := x * s; sx < (x+1)*s; sx++ {
+					sum += int(rgba.Pix[rgba.PixOffset(sx, sy)+3])
+				}
+			}
+			alpha.Pix[y*alpha.Stride+x] = uint8((sum + s*s/2) / (s * s))
 		}
 	}
 	return alpha
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-// loadFontFromURL downloads a font from a URL and returns the font bytes
-func loadFontFromURL(url string) ([]byte, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, err
-	}
-
-	return io.ReadAll(resp.Body)
-}
-
-// loadFontFromSystem attempts to load a system font by name
-// Tries common system font directories for the given font name
-func loadFontFromSystem(fontName string) ([]byte, error) {
-	// Common system font directories
-	fontDirs := []string{
-		"/usr/share/fonts/truetype",     // Linux : ex: /usr/share/fonts/truetype/dejavu/DejaVuSans.ttf
-		"/System/Library/Fonts",         // macOS
-		"/Library/Fonts",                // macOS
-		"C:\\Windows\\Fonts",            // Windows
-		os.ExpandEnv("$WINDIR\\Fonts"),  // Windows via env var
-		os.ExpandEnv("$ITENG_FONT_DIR"), // Custom font dir via env var
-	}
-
-	// Common font file extensions
-	extensions := []string{".ttf", ".otf"}
-
-	for _, dir := range fontDirs {
-		for _, ext := range extensions {
-			fontPath := filepath.Join(dir, fontName+ext)
-			if data, err := os.ReadFile(fontPath); err == nil {
-				return data, nil
+// parseHexColor parses #RGB, #RRGGBB or #RRGGBBAA, the forms gg's SetHexColor accepts
+func parseHexColor(s string) (color.NRGBA, error) {
+	x := strings.TrimPrefix(s, "#")
+	var v [4]uint8
+	v[3] = 255
+	switch len(x) {
+	case 3:
+		for i := 0; i < 3; i++ {
+			d, ok := hexDigit(x[i])
+			if !ok {
+				return color.NRGBA{}, fmt.Errorf("invalid hex color %q", s)
 			}
-
-			// Try with different case variations on case-insensitive systems
-			fontPath = filepath.Join(dir, strings.ToLower(fontName)+ext)
-			if data, err := os.ReadFile(fontPath); err == nil {
-				return data, nil
+			v[i] = d<<4 | d
+		}
+	case 6, 8:
+		for i := 0; i < len(x)/2; i++ {
+			hi, ok1 := hexDigit(x[2*i])
+			lo, ok2 := hexDigit(x[2*i+1])
+			if !ok1 || !ok2 {
+				return color.NRGBA{}, fmt.Errorf("invalid hex color %q", s)
 			}
+			v[i] = hi<<4 | lo
 		}
+	default:
+		return color.NRGBA{}, fmt.Errorf("invalid hex color %q", s)
 	}
-
-	return nil, os.ErrNotExist
-}
-
-// tryLoadFont attempts to load a font using the gg context's LoadFontFace method
-// This tries direct file path loading
-func tryLoadFont(dc *gg.Context, fontPath string, fontSize float64) error {
-	return dc.LoadFontFace(fontPath, fontSize)
+	return color.NRGBA{v[0], v[1], v[2], v[3]}, nil
 }
 
-// tryLoadFontFromBytes attempts to load a font from byte data
-// This requires parsing the font data directly (gg context doesn't support this natively,
-// so we create a temp file)
-func tryLoadFontFromBytes(dc *gg.Context, fontData []byte, fontSize float64) error {
-	// Create a temporary file for the font data
-	tmpFile, err := os.CreateTemp("", "font-*.ttf")
-	if err != nil {
-		return err
+func hexDigit(c byte) (uint8, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
 	}
-	defer os.Remove(tmpFile.Name())
+	return 0, false
+}
 
-	if _, err := tmpFile.Write(fontData); err != nil {
-		tmpFile.Close()
-		return err
+func min(a, b int) int {
+	if a < b {
+		return a
 	}
-	tmpFile.Close()
-
-	return dc.LoadFontFace(tmpFile.Name(), fontSize)
+	return b
 }
 
 // DrawTextInto draws text into the canvas using gg and supports wrapping and alignment
 // Supports loading fonts from filesystem, URLs, system fonts, or embedded resources
 // Font loading priority:
-//  1. If FontSource is specified, use that source explicitly
+//  1. If FontSource is specified, use that source explicitly,
+//     "embedded" looks up FontName in the font registry
 //  2. If FontPath is provided, try filesystem
 //  3. If FontURL is provided, try downloading from URL
-//  4. If FontName is provided, try system fonts
+//  4. If FontName is provided, try fonts registered in DefaultFontRegistry, then system fonts
 //  5. Use FONT_DIR/FONT_TTF environment variables
-//  6. Fall back to gg's builtin font
+//  6. Fall back to the embedded DefaultFont
+//  7. Fall back to gg's builtin font
+//
+// TextOpts.Fonts, each found the same way, and then DefaultFont are used for
+// any rune the font found above has no glyph for.
+//
+// Fonts are parsed once and cached in DefaultFontRegistry.
 //
 // Note: dc must be initialized with the correct size before calling this function
-// TODO: support vertical alignment
-// TODO: support more text options like line spacing, etc.
 func (slot Slot) DrawTextInto(dc *gg.Context, text string) {
-	// Load font if provided
-	var fontLoaded bool
-	opts := slot.TextOpts
+	_, _ = slot.DrawTextIntoContext(context.Background(), dc, text)
+}
 
-	// Determine font source priority
-	fontSource := strings.ToLower(opts.FontSource)
+// TextResult describes how DrawTextIntoContext drew a text slot
+type TextResult struct {
+	// Font is the font that was used, e.g. "file:fonts/title.ttf", or DefaultFont
+	Font string
+	// Fonts is the fallback chain that was loaded, starting with Font
+	Fonts []string
+	// FontSize is the size the text was drawn at, chosen by TextOpt.Fit
+	FontSize float64
+	// Truncated is set when lines were dropped or shortened to fit
+	Truncated bool
+	// Bounds is the box the text was laid out in, after Slot.Rotation
+	Bounds image.Rectangle
+	// MarkupErr is why TextOpt.Markup text could not be parsed,
+	// the text is then drawn without its tags
+	MarkupErr error
+	// FontFallback is set when a fallback font was used in place of the requested font
+	FontFallback bool
+	// FontErr is why the requested font could not be used
+	FontErr error
+}
 
-	log.Printf("DrawTextInto: font source: %s", fontSource)
+// DrawTextIntoContext is DrawTextInto with a context that bounds font downloads.
+// It returns ctx.Err() without drawing if ctx is done before the text is drawn.
+func (slot Slot) DrawTextIntoContext(ctx context.Context, dc *gg.Context, text string) (TextResult, error) {
+	return slot.drawText(ctx, dc, DefaultFontRegistry, text)
+}
 
-	// Try explicit source first
-	if fontSource == "url" && opts.FontURL != "" {
-		if fontData, err := loadFontFromURL(opts.FontURL); err == nil {
-			if err := tryLoadFontFromBytes(dc, fontData, opts.FontSize); err == nil {
-				fontLoaded = true
-			} else {
-				log.Printf("warning: DrawTextInto: Failed to load font from URL %s: %v", opts.FontURL, err)
-			}
-		} else {
-			log.Printf("warning: DrawTextInto: Failed to download font from URL %s: %v", opts.FontURL, err)
-		}
-	} else if fontSource == "system" && opts.FontName != "" {
-		if fontData, err := loadFontFromSystem(opts.FontName); err == nil {
-			if err := tryLoadFontFromBytes(dc, fontData, opts.FontSize); err == nil {
-				fontLoaded = true
-			} else {
-				log.Printf("warning: DrawTextInto: Failed to load system font %s: %v", opts.FontName, err)
-			}
-		} else {
-			log.Printf("warning: DrawTextInto: Failed to find system font %s", opts.FontName)
-		}
-	} else if fontSource == "file" && opts.FontPath != "" {
-		if err := tryLoadFont(dc, opts.FontPath, opts.FontSize); err == nil {
-			fontLoaded = true
-		} else {
-			log.Printf("warning: DrawTextInto: Failed to load font from file %s: %v", opts.FontPath, err)
-		}
+// drawText draws the text using fonts from the registry
+func (slot Slot) drawText(ctx context.Context, dc *gg.Context, fonts *FontRegistry, text string) (TextResult, error) {
+	if err := ctx.Err(); err != nil {
+		return TextResult{}, err
 	}
 
-	// If explicit source didn't work, try automatic discovery
-	if !fontLoaded {
-		log.Printf("warning: DrawTextInto: no explicit font source provided, trying automatic discovery")
-
-		// Try environment variables first
-		if !fontLoaded {
-			ttfFile := os.Getenv("ITENG_FONT_TTF")
-			if ttfFile != "" {
-				ttfPath := filepath.Join(os.Getenv("ITENG_FONT_DIR"), ttfFile)
-				if err := tryLoadFont(dc, ttfPath, opts.FontSize); err == nil {
-					fontLoaded = true
-				}
-			}
-		}
-
-		// Try filesystem path
-		if opts.FontPath != "" {
-			if err := tryLoadFont(dc, opts.FontPath, opts.FontSize); err == nil {
-				fontLoaded = true
-			}
-		}
-
-		// Try URL
-		if !fontLoaded && opts.FontURL != "" {
-			if fontData, err := loadFontFromURL(opts.FontURL); err == nil {
-				if err := tryLoadFontFromBytes(dc, fontData, opts.FontSize); err == nil {
-					fontLoaded = true
-				}
-			}
-		}
+	opts := slot.TextOpts
+	res, chain := fonts.resolveTextFonts(ctx, opts)
 
-		// Try system font by name
-		if !fontLoaded && opts.FontName != "" {
-			if fontData, err := loadFontFromSystem(opts.FontName); err == nil {
-				if err := tryLoadFontFromBytes(dc, fontData, opts.FontSize); err == nil {
-					fontLoaded = true
-				}
-			}
-		}
+	if err := ctx.Err(); err != nil {
+		return res, err
 	}
 
-	if !fontLoaded && opts.FontSize > 0 {
-		log.Printf("warning: DrawTextInto: Failed to load font: using builtin font")
+	base := opts.baseStyle(chain)
+	spans := []textSpan{{text: text, style: base}}
+	if opts.Markup {
+		spans = fonts.markupSpans(ctx, opts, base, text, &res)
 	}
 
-	// parse color
-	if opts.Color != "" {
-		// assume hex: #RRGGBB : opts.Color
-		dc.SetHexColor(opts.Color)
-	} else {
-		dc.SetRGB(0, 0, 0)
-	}
+	layout := slot.layoutSpans(spans, base)
+	res.FontSize = layout.size
+	res.Truncated = layout.truncated
 
 	// compute anchor point inside slot
-	ax := slot.AnchorX
-	ay := slot.AnchorY
-	if ax < 0 || ax > 1 {
-		ax = 0.0
-	}
-	if ay < 0 || ay > 1 {
-		ay = 0.0
-	}
+	ax, ay := slot.EffectiveAnchor()
 	px := float64(slot.X) + float64(slot.Width)*ax
 	py := float64(slot.Y) + float64(slot.Height)*ay
 
 	// horizontal alignment mapping
 	hAlign := strings.ToLower(opts.AlignX)
 	var anchorX float64
+	justify := hAlign == "justify"
 	switch hAlign {
 	case "center", "centre":
 		anchorX = 0.5
@@ -426,11 +495,54 @@ func (slot Slot) DrawTextInto(dc *gg.Context, text string) {
 		anchorY = 0.0
 	}
 
-	// wrapped or single-line
-	if opts.Wrap && opts.MaxWidth > 0 {
-		// DrawStringWrapped(x, y, ax, ay, width, lineSpacing, align)
-		dc.DrawStringWrapped(text, px, py, anchorX, anchorY, float64(opts.MaxWidth), 1.4, gg.AlignLeft)
+	// wrapped text is aligned as a box of the wrap width
+	box := textBox{w: layout.width, h: layout.height, align: anchorX, justify: justify}
+	wrap := slot.wrapWidth()
+	if opts.vertical() {
+		// columns are aligned down a box of the wrap length
+		box = textBox{w: layout.height, h: layout.width, align: anchorY}
+		if wrap > 0 {
+			box.h = wrap
+		}
+	} else if wrap > 0 {
+		box.w = wrap
+	}
+	box.x, box.y = px-box.w*anchorX, py-box.h*anchorY
+	if !opts.block() && len(layout.lines) > 0 {
+		// the first baseline is where gg's DrawStringAnchored and
+		// DrawStringWrapped put it, a font height below the top of the lines
+		first, last := layout.lines[0], layout.lines[len(layout.lines)-1]
+		baseline := py + first.height*anchorY
+		if wrap > 0 {
+			baseline = py - (last.baseline-first.baseline+first.height)*anchorY + first.height
+		}
+		box.y = baseline - first.baseline
+	}
+	// right to left paragraphs start at the right of the box
+	layout.alignStart = hAlign == ""
+	res.Bounds = box.rotatedBounds(slot.Rotation, px, py)
+	if opts.Background != nil {
+		for _, r := range layout.backgroundRects(box, *opts.Background) {
+			res.Bounds = res.Bounds.Union(r.rotatedBounds(slot.Rotation, px, py))
+		}
+	}
+
+	if slot.Rotation != 0 {
+		dc.Push()
+		defer dc.Pop()
+		dc.RotateAbout(gg.Radians(slot.Rotation), px, py)
+	}
+	if opts.Background != nil {
+		layout.drawBackground(dc, box, *opts.Background)
+	}
+	if opts.Stroke != nil || len(opts.Shadows) > 0 {
+		// the canvas as seen by the rotated text
+		view := textBox{w: float64(dc.Width()), h: float64(dc.Height())}
+		r := view.rotatedBounds(-slot.Rotation, px, py)
+		view = textBox{x: float64(r.Min.X), y: float64(r.Min.Y), w: float64(r.Dx()), h: float64(r.Dy())}
+		layout.drawEffects(dc, box, view, opts)
 	} else {
-		dc.DrawStringAnchored(text, px, py, anchorX, anchorY)
+		layout.draw(dc, box)
 	}
+	return res, nil
 }
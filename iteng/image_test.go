@@ -15,9 +15,15 @@
 package iteng
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"image"
 	"image/color"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/fogleman/gg"
@@ -554,7 +560,7 @@ func Test_DrawTextInto_LeftAlignment(t *testing.T) {
 		Y:       10,
 		Width:   180,
 		Height:  80,
-		AnchorX: 0.0, // left
+		AnchorX: Float(0.0), // left
 		TextOpts: TextOpt{
 			FontSize: 20,
 			AlignX:   "left",
@@ -576,7 +582,7 @@ func Test_DrawTextInto_CenterAlignment(t *testing.T) {
 		Y:       10,
 		Width:   180,
 		Height:  80,
-		AnchorX: 0.5, // center
+		AnchorX: Float(0.5), // center
 		TextOpts: TextOpt{
 			FontSize: 20,
 			AlignX:   "center",
@@ -598,7 +604,7 @@ func Test_DrawTextInto_RightAlignment(t *testing.T) {
 		Y:       10,
 		Width:   180,
 		Height:  80,
-		AnchorX: 1.0, // right
+		AnchorX: Float(1.0), // right
 		TextOpts: TextOpt{
 			FontSize: 20,
 			AlignX:   "right",
@@ -620,7 +626,7 @@ func Test_DrawTextInto_VerticalAlignment_Top(t *testing.T) {
 		Y:       10,
 		Width:   180,
 		Height:  80,
-		AnchorY: 0.0, // top
+		AnchorY: Float(0.0), // top
 		TextOpts: TextOpt{
 			FontSize: 20,
 			AlignY:   "top",
@@ -642,7 +648,7 @@ func Test_DrawTextInto_VerticalAlignment_Middle(t *testing.T) {
 		Y:       10,
 		Width:   180,
 		Height:  80,
-		AnchorY: 0.5, // middle
+		AnchorY: Float(0.5), // middle
 		TextOpts: TextOpt{
 			FontSize: 20,
 			AlignY:   "middle",
@@ -664,7 +670,7 @@ func Test_DrawTextInto_VerticalAlignment_Bottom(t *testing.T) {
 		Y:       10,
 		Width:   180,
 		Height:  80,
-		AnchorY: 1.0, // bottom
+		AnchorY: Float(1.0), // bottom
 		TextOpts: TextOpt{
 			FontSize: 20,
 			AlignY:   "bottom",
@@ -730,7 +736,7 @@ func Test_DrawTextInto_InvalidAnchorX(t *testing.T) {
 		Y:       10,
 		Width:   180,
 		Height:  80,
-		AnchorX: 2.5, // Invalid, should clamp to 0.0
+		AnchorX: Float(2.5), // Invalid, should clamp to 0.0
 		TextOpts: TextOpt{
 			FontSize: 20,
 		},
@@ -751,7 +757,7 @@ func Test_DrawTextInto_InvalidAnchorY(t *testing.T) {
 		Y:       10,
 		Width:   180,
 		Height:  80,
-		AnchorY: -0.5, // Invalid, should clamp to 0.0
+		AnchorY: Float(-0.5), // Invalid, should clamp to 0.0
 		TextOpts: TextOpt{
 			FontSize: 20,
 		},
@@ -891,3 +897,85 @@ func Test_DrawTextInto_WithEnvFontVars(t *testing.T) {
 		t.Errorf("Context dimensions changed: got %dx%d, expected 200x100", dc.Width(), dc.Height())
 	}
 }
+
+func Test_loadFontFromURL_BadStatus(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	data, err := loadFontFromURL(context.Background(), srv.URL+"/missing.ttf")
+	if err == nil {
+		t.Errorf("loadFontFromURL should have returned an error for a 404 but returned %d bytes", len(data))
+	}
+}
+
+func Test_ResizeImageContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	src := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	if _, err := ResizeImageContext(ctx, src, 5, 5, ResizeModeFill); !errors.Is(err, context.Canceled) {
+		t.Errorf("ResizeImageContext with cancelled context returned %v; expected %v", err, context.Canceled)
+	}
+
+	img, err := ResizeImageContext(context.Background(), src, 5, 5, ResizeModeFill)
+	if err != nil {
+		t.Fatalf("ResizeImageContext returned error: %v", err)
+	}
+	if img.Bounds().Dx() != 5 || img.Bounds().Dy() != 5 {
+		t.Errorf("ResizeImageContext dimensions incorrect: got %dx%d, expected 5x5", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+}
+
+func Test_ResizeImageFocus(t *testing.T) {
+	// red on the left half and green on the right
+	src := halvesImage(40, 10)
+	tests := []struct {
+		fx          float64
+		left, right color.RGBA
+	}{
+		{0, color.RGBA{255, 0, 0, 255}, color.RGBA{255, 0, 0, 255}},
+		{0.5, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}},
+		{1, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 255, 0, 255}},
+		// a focus near the edge keeps the crop inside the image
+		{0.95, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 255, 0, 255}},
+	}
+	for _, tt := range tests {
+		img := ResizeImageFocus(src, 10, 10, ResizeModeCover, tt.fx, 0.5).(*image.RGBA)
+		if img.Bounds().Dx() != 10 || img.Bounds().Dy() != 10 {
+			t.Fatalf("ResizeImageFocus returned %v; expected 10x10", img.Bounds())
+		}
+		if left, right := img.RGBAAt(1, 5), img.RGBAAt(8, 5); left != tt.left || right != tt.right {
+			t.Errorf("focus %g: crop is %v to %v; expected %v to %v", tt.fx, left, right, tt.left, tt.right)
+		}
+	}
+}
+
+func Test_ResizeImage_ModeCase(t *testing.T) {
+	src := halvesImage(40, 10)
+	for _, mode := range []ResizeMode{ResizeModeFill, ResizeModeFit, ResizeModeCover} {
+		want := ResizeImage(src, 10, 10, mode).(*image.RGBA)
+		got := ResizeImage(src, 10, 10, ResizeMode(strings.ToUpper(string(mode)))).(*image.RGBA)
+		if got.Bounds() != want.Bounds() || !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("mode %q resized to %v unlike %q", strings.ToUpper(string(mode)), got.Bounds(), mode)
+		}
+	}
+}
+
+func Test_CropImage(t *testing.T) {
+	src := halvesImage(20, 10)
+	crop := CropImage(src, image.Rect(10, 0, 20, 10))
+	if b := crop.Bounds(); b.Dx() != 10 || b.Dy() != 10 {
+		t.Fatalf("CropImage returned %v; expected 10x10", b)
+	}
+	if r, g, _, _ := crop.At(crop.Bounds().Min.X, 0).RGBA(); r != 0 || g>>8 != 255 {
+		t.Errorf("crop of the right half starts with r=%d g=%d; expected green", r>>8, g>>8)
+	}
+
+	// the crop is clipped to the image, and a crop outside it is ignored
+	if b := CropImage(src, image.Rect(15, 5, 50, 50)).Bounds(); b.Dx() != 5 || b.Dy() != 5 {
+		t.Errorf("clipped crop is %v; expected 5x5", b)
+	}
+	if b := CropImage(src, image.Rect(30, 30, 40, 40)).Bounds(); b != src.Bounds() {
+		t.Errorf("crop outside the image is %v; expected the whole image", b)
+	}
+}
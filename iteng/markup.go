@@ -0,0 +1,282 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Text slot markup, enabled with TextOpt.Markup:
+//
+//	<b>bold</b> or <strong>
+//	<i>italic</i> or <em>
+//	<u>underlined</u>
+//	<s>struck through</s> or <del>
+//	<span font="Brand Bold" size="48" color="#ff0000">styled</span>
+//	line<br>break
+//
+// Tags nest, and &lt; &gt; &amp; and the other HTML entities stand for
+// the characters they name.
+
+// markupStyle is the styling markup asks for on a span of text.
+// Empty fields keep the TextOpt style.
+type markupStyle struct {
+	bold, italic, underline, strike bool
+	font                            string
+	size                            float64
+	color                           string
+}
+
+// markupSpan is text with the markup style it is drawn in
+type markupSpan struct {
+	text  string
+	style markupStyle
+}
+
+// parseMarkup splits s into spans of text in one style
+func parseMarkup(s string) ([]markupSpan, error) {
+	var spans []markupSpan
+	type open struct {
+		name  string
+		style markupStyle
+	}
+	var stack []open
+	style := markupStyle{}
+
+	addText := func(text string) {
+		if text == "" {
+			return
+		}
+		text = html.UnescapeString(text)
+		if n := len(spans); n > 0 && spans[n-1].style == style {
+			spans[n-1].text += text
+			return
+		}
+		spans = append(spans, markupSpan{text: text, style: style})
+	}
+
+	for s != "" {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			addText(s)
+			break
+		}
+		addText(s[:lt])
+		gt := strings.IndexByte(s[lt:], '>')
+		if gt < 0 {
+			return nil, fmt.Errorf("unterminated tag %q", s[lt:])
+		}
+		tag := s[lt+1 : lt+gt]
+		s = s[lt+gt+1:]
+
+		if strings.HasPrefix(tag, "/") {
+			name := strings.ToLower(strings.TrimSpace(tag[1:]))
+			if len(stack) == 0 || stack[len(stack)-1].name != name {
+				return nil, fmt.Errorf("unexpected closing tag </%s>", name)
+			}
+			style = stack[len(stack)-1].style
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		name, attrs, err := parseTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if name == "br" {
+			addText("\n")
+			continue
+		}
+		next, err := style.apply(name, attrs)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, open{name: name, style: style})
+		style = next
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unclosed tag <%s>", stack[len(stack)-1].name)
+	}
+	return spans, nil
+}
+
+// apply returns the style inside the tag name with the attributes attrs
+func (st markupStyle) apply(name string, attrs map[string]string) (markupStyle, error) {
+	if name != "span" && len(attrs) > 0 {
+		return st, fmt.Errorf("tag <%s> takes no attributes", name)
+	}
+	switch name {
+	case "b", "strong":
+		st.bold = true
+	case "i", "em":
+		st.italic = true
+	case "u":
+		st.underline = true
+	case "s", "del":
+		st.strike = true
+	case "span":
+		for k, v := range attrs {
+			switch k {
+			case "font":
+				st.font = v
+			case "size":
+				size, err := strconv.ParseFloat(v, 64)
+				if err != nil || size <= 0 {
+					return st, fmt.Errorf("invalid span size %q", v)
+				}
+				st.size = size
+			case "color":
+				if _, err := parseHexColor(v); err != nil {
+					return st, fmt.Errorf("invalid span color: %v", err)
+				}
+				st.color = v
+			default:
+				return st, fmt.Errorf("unknown span attribute %q", k)
+			}
+		}
+	default:
+		return st, fmt.Errorf("unknown tag <%s>", name)
+	}
+	return st, nil
+}
+
+// parseTag splits the inside of a tag into its lower case name and attributes
+func parseTag(tag string) (string, map[string]string, error) {
+	tag = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(tag), "/"))
+	end := strings.IndexFunc(tag, unicode.IsSpace)
+	if end < 0 {
+		end = len(tag)
+	}
+	name := strings.ToLower(tag[:end])
+	if name == "" {
+		return "", nil, fmt.Errorf("empty tag")
+	}
+
+	attrs := make(map[string]string)
+	rest := strings.TrimSpace(tag[end:])
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return "", nil, fmt.Errorf("invalid attribute %q in <%s>", rest, name)
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+			return "", nil, fmt.Errorf("attribute %s in <%s> needs a quoted value", key, name)
+		}
+		closing := strings.IndexByte(rest[1:], rest[0])
+		if closing < 0 {
+			return "", nil, fmt.Errorf("unterminated value for attribute %s in <%s>", key, name)
+		}
+		attrs[key] = html.UnescapeString(rest[1 : closing+1])
+		rest = strings.TrimSpace(rest[closing+2:])
+	}
+	return name, attrs, nil
+}
+
+// stripMarkup returns the text of s without its tags, for when the markup is invalid
+func stripMarkup(s string) string {
+	var b strings.Builder
+	for s != "" {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			b.WriteString(s)
+			break
+		}
+		gt := strings.IndexByte(s[lt:], '>')
+		if gt < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:lt])
+		s = s[lt+gt+1:]
+	}
+	return html.UnescapeString(b.String())
+}
+
+// markupSpans parses text as markup into spans styled from base. Fonts named
+// by spans, and TextOpt.BoldFont and ItalicFont, are loaded from the registry
+// with TextOpt.Fonts as their fallbacks. Invalid markup is drawn without its
+// tags and reported in res.MarkupErr, fonts that cannot be loaded make
+// res a font fallback.
+func (r *FontRegistry) markupSpans(ctx context.Context, opts TextOpt, base *textStyle, text string, res *TextResult) []textSpan {
+	parsed, err := parseMarkup(text)
+	if err != nil {
+		res.MarkupErr = err
+		return []textSpan{{text: stripMarkup(text), style: base}}
+	}
+
+	chains := make(map[FontRef]fontChain)
+	chainFor := func(ref FontRef) fontChain {
+		if chain, ok := chains[ref]; ok {
+			return chain
+		}
+		fontOpts := TextOpt{FontSource: ref.Source, FontPath: ref.Path, FontName: ref.Name, FontURL: ref.URL, Fonts: opts.Fonts}
+		fr, chain := r.resolveTextFonts(ctx, fontOpts)
+		if fr.FontFallback {
+			res.FontFallback = true
+			if res.FontErr == nil {
+				res.FontErr = fr.FontErr
+			}
+		}
+		chains[ref] = chain
+		return chain
+	}
+
+	// text outside tags is in the base style
+	styles := map[markupStyle]*textStyle{{}: base}
+	spans := make([]textSpan, len(parsed))
+	for i, p := range parsed {
+		st, ok := styles[p.style]
+		if !ok {
+			st = &textStyle{
+				chain:     base.chain,
+				size:      base.size,
+				color:     base.color,
+				bold:      p.style.bold,
+				italic:    p.style.italic,
+				underline: p.style.underline,
+				strike:    p.style.strike,
+			}
+			// a font named by the span is used as is, otherwise the
+			// configured bold or italic font replaces the synthesized style
+			switch {
+			case p.style.font != "":
+				st.chain = chainFor(FontRef{Name: p.style.font})
+			case p.style.bold && opts.BoldFont != nil:
+				st.chain = chainFor(*opts.BoldFont)
+				st.bold = false
+			case p.style.italic && opts.ItalicFont != nil:
+				st.chain = chainFor(*opts.ItalicFont)
+				st.italic = false
+			}
+			if p.style.size > 0 {
+				st.size = p.style.size
+			}
+			if p.style.color != "" {
+				st.color = hexColorOr(p.style.color, base.color)
+			}
+			styles[p.style] = st
+		}
+		spans[i] = textSpan{text: p.text, style: st}
+	}
+	return spans
+}
@@ -0,0 +1,113 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"context"
+	"image/color"
+	"testing"
+)
+
+func Test_parseMarkup(t *testing.T) {
+	spans, err := parseMarkup(`Only <b>today</b>: <span color="#f00" size='30'>$9 <u>off</u></span><br>Tom &amp; Jerry &lt;3`)
+	if err != nil {
+		t.Fatalf("parseMarkup returned error: %v", err)
+	}
+
+	expected := []markupSpan{
+		{text: "Only "},
+		{text: "today", style: markupStyle{bold: true}},
+		{text: ": "},
+		{text: "$9 ", style: markupStyle{color: "#f00", size: 30}},
+		{text: "off", style: markupStyle{color: "#f00", size: 30, underline: true}},
+		{text: "\nTom & Jerry <3"},
+	}
+	if len(spans) != len(expected) {
+		t.Fatalf("parseMarkup returned %d spans %+v; expected %d", len(spans), spans, len(expected))
+	}
+	for i := range expected {
+		if spans[i] != expected[i] {
+			t.Errorf("span %d = %+v; expected %+v", i, spans[i], expected[i])
+		}
+	}
+}
+
+func Test_parseMarkup_Invalid(t *testing.T) {
+	tests := []string{
+		"<b>unclosed",
+		"<b>crossed <i>tags</b></i>",
+		"closing</b>",
+		"<blink>unknown</blink>",
+		`<span weight="bold">unknown attribute</span>`,
+		`<span size="big">bad size</span>`,
+		`<span color="red">bad color</span>`,
+		`<span font=Brand>unquoted</span>`,
+		"<b",
+	}
+	for _, markup := range tests {
+		if _, err := parseMarkup(markup); err == nil {
+			t.Errorf("parseMarkup(%q) returned no error", markup)
+		}
+	}
+
+	if s := stripMarkup("<b>Tom</b> &amp; <blink>Jerry"); s != "Tom & Jerry" {
+		t.Errorf("stripMarkup = %q; expected %q", s, "Tom & Jerry")
+	}
+}
+
+func Test_markupSpans(t *testing.T) {
+	r := NewFontRegistry()
+	if err := r.RegisterFile("Tagalog", "../test/NotoSansTagalog-Regular.ttf"); err != nil {
+		t.Fatalf("RegisterFile returned error: %v", err)
+	}
+	opts := TextOpt{FontSize: 20, Color: "#000000", Markup: true, BoldFont: &FontRef{Name: "Tagalog"}}
+	var res TextResult
+	_, chain := r.resolveTextFonts(context.Background(), opts)
+	base := opts.baseStyle(chain)
+
+	spans := r.markupSpans(context.Background(), opts, base, `a<b>b</b><i>c</i><span font="Tagalog" size="40" color="#0f0">d</span>`, &res)
+	if res.MarkupErr != nil || res.FontFallback {
+		t.Fatalf("markupSpans reported %v, %v", res.MarkupErr, res.FontErr)
+	}
+	if len(spans) != 4 {
+		t.Fatalf("markupSpans returned %d spans; expected 4", len(spans))
+	}
+
+	if spans[0].style != base {
+		t.Errorf("plain text is not in the base style")
+	}
+	if bold := spans[1].style; bold.bold || bold.chain.keys[0] != "Tagalog" {
+		t.Errorf("bold text uses %v synthesized %v; expected the bold font", bold.chain.keys, bold.bold)
+	}
+	if italic := spans[2].style; !italic.italic || italic.chain.keys[0] != chain.keys[0] {
+		t.Errorf("italic text is not synthesized from the base font")
+	}
+	span := spans[3].style
+	if span.chain.keys[0] != "Tagalog" || span.size != 40 || span.color != (color.NRGBA{0, 255, 0, 255}) {
+		t.Errorf("span style = %v %g %v; expected Tagalog 40 #0f0", span.chain.keys, span.size, span.color)
+	}
+
+	// unknown fonts fall back and invalid markup is drawn without tags
+	res = TextResult{}
+	r.markupSpans(context.Background(), opts, base, `<span font="Unknown">x</span>`, &res)
+	if !res.FontFallback {
+		t.Errorf("unknown span font was not reported as a fallback")
+	}
+	res = TextResult{}
+	spans = r.markupSpans(context.Background(), opts, base, `<b>x`, &res)
+	if res.MarkupErr == nil || len(spans) != 1 || spans[0].text != "x" {
+		t.Errorf("invalid markup returned %+v, %v", spans, res.MarkupErr)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"image"
+	"math"
+	"strings"
+
+	imagedraw "golang.org/x/image/draw"
+)
+
+// slotMask returns the mask of an image slot for its w x h resized image,
+// feathered and then inverted as the slot asks. maskImg is the loaded
+// Slot.MaskImage, an image mask without one is opaque.
+func (slot Slot) slotMask(w, h int, maskImg image.Image) *image.Alpha {
+	var m *image.Alpha
+	switch kind := strings.ToLower(slot.Mask); kind {
+	case "image":
+		if maskImg != nil {
+			m = ImageMask(maskImg, w, h)
+		} else {
+			m = MakeMask("", w, h, 0)
+		}
+	case "linear", "radial":
+		g := MaskGradient{}
+		if slot.MaskGradient != nil {
+			g = *slot.MaskGradient
+		}
+		m = GradientMask(kind, w, h, g)
+	default:
+		m = MakeMask(kind, w, h, slot.Radius)
+	}
+	FeatherMask(m, slot.MaskFeather)
+	if slot.MaskInvert {
+		InvertMask(m)
+	}
+	return m
+}
+
+// ImageMask returns a w x h mask made from img, stretched to fit. Images with
+// transparent pixels mask by their alpha, opaque images by their brightness,
+// so white shows the slot and black hides it.
+func ImageMask(img image.Image, w, h int) *image.Alpha {
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	imagedraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), imagedraw.Src, nil)
+
+	m := image.NewAlpha(scaled.Bounds())
+	opaque := scaled.Opaque()
+	for i := 0; i < len(m.Pix); i++ {
+		px := scaled.Pix[i*4 : i*4+4 : i*4+4]
+		if opaque {
+			m.Pix[i] = clampUint8(0.299*float64(px[0]) + 0.587*float64(px[1]) + 0.114*float64(px[2]))
+		} else {
+			m.Pix[i] = px[3]
+		}
+	}
+	return m
+}
+
+// GradientMask returns a w x h mask that fades from opaque to transparent.
+// kind "linear" fades along the direction of g.Angle, "radial" out from the
+// center g.CenterX, g.CenterY to the farthest corner.
+func GradientMask(kind string, w, h int, g MaskGradient) *image.Alpha {
+	m := image.NewAlpha(image.Rect(0, 0, w, h))
+	start, end := g.Start, g.EffectiveEnd()
+
+	// pos is how far along the gradient a point is, from 0 to 1
+	var pos func(x, y float64) float64
+	if strings.EqualFold(kind, "radial") {
+		cx, cy := unitOr(g.CenterX, 0.5)*float64(w), unitOr(g.CenterY, 0.5)*float64(h)
+		far := math.Hypot(math.Max(cx, float64(w)-cx), math.Max(cy, float64(h)-cy))
+		pos = func(x, y float64) float64 { return math.Hypot(x-cx, y-cy) / far }
+	} else {
+		// project onto the direction, from the first corner it reaches to the last
+		sin, cos := math.Sincos(g.Angle * math.Pi / 180)
+		lo := math.Min(0, float64(w)*cos) + math.Min(0, float64(h)*sin)
+		hi := math.Max(0, float64(w)*cos) + math.Max(0, float64(h)*sin)
+		pos = func(x, y float64) float64 { return (x*cos + y*sin - lo) / (hi - lo) }
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			t := pos(float64(x)+0.5, float64(y)+0.5)
+			a := 1.0
+			switch {
+			case t >= end:
+				a = 0
+			case t > start:
+				a = (end - t) / (end - start)
+			}
+			m.Pix[y*m.Stride+x] = clampUint8(a * 255)
+		}
+	}
+	return m
+}
+
+// FeatherMask softens the edges of m in place over about feather pixels with
+// a gaussian blur of that radius, as GaussianBlur. Past the bounds of m is
+// transparent, so the edges of the mask fade too.
+func FeatherMask(m *image.Alpha, feather float64) {
+	blurAlpha(m, feather/2)
+}
+
+// InvertMask swaps the shown and hidden parts of m in place
+func InvertMask(m *image.Alpha) {
+	for i, a := range m.Pix {
+		m.Pix[i] = 255 - a
+	}
+}
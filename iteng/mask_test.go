@@ -0,0 +1,184 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func Test_GradientMask(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   string
+		g      MaskGradient
+		x, y   int
+		lo, hi uint8
+	}{
+		{"linear start", "linear", MaskGradient{}, 0, 0, 247, 250},
+		{"linear end", "linear", MaskGradient{}, 19, 0, 5, 8},
+		{"linear middle", "linear", MaskGradient{}, 10, 0, 120, 125},
+		{"linear down", "linear", MaskGradient{Angle: 90}, 5, 19, 5, 8},
+		{"linear opaque before start", "linear", MaskGradient{Start: 0.5}, 9, 0, 255, 255},
+		{"linear clear after end", "linear", MaskGradient{End: Float(0.5)}, 10, 0, 0, 0},
+		{"radial center", "radial", MaskGradient{}, 10, 10, 240, 255},
+		{"radial corner", "radial", MaskGradient{}, 0, 0, 10, 15},
+		{"radial moved center", "radial", MaskGradient{CenterX: Float(0), CenterY: Float(0)}, 0, 0, 245, 255},
+	}
+	for _, tt := range tests {
+		m := GradientMask(tt.kind, 20, 20, tt.g)
+		if a := m.AlphaAt(tt.x, tt.y).A; a < tt.lo || a > tt.hi {
+			t.Errorf("%s: alpha at %d,%d = %d; expected %d..%d", tt.name, tt.x, tt.y, a, tt.lo, tt.hi)
+		}
+	}
+}
+
+func Test_ImageMask(t *testing.T) {
+	// opaque images mask by brightness, stretched to the slot
+	bw := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	bw.SetRGBA(0, 0, color.RGBA{0, 0, 0, 255})
+	bw.SetRGBA(1, 0, color.RGBA{255, 255, 255, 255})
+	m := ImageMask(bw, 10, 4)
+	if m.Bounds() != image.Rect(0, 0, 10, 4) {
+		t.Fatalf("mask bounds = %v; expected the slot size", m.Bounds())
+	}
+	if l, r := m.AlphaAt(0, 2).A, m.AlphaAt(9, 2).A; l != 0 || r != 255 {
+		t.Errorf("black and white mask = %d on the left and %d on the right; expected 0 and 255", l, r)
+	}
+
+	// images with transparency mask by alpha, whatever their color
+	shape := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	shape.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	shape.SetNRGBA(1, 0, color.NRGBA{255, 255, 255, 0})
+	m = ImageMask(shape, 10, 4)
+	if l, r := m.AlphaAt(0, 2).A, m.AlphaAt(9, 2).A; l != 255 || r != 0 {
+		t.Errorf("alpha mask = %d on the left and %d on the right; expected 255 and 0", l, r)
+	}
+}
+
+func Test_Slot_slotMask_Invert(t *testing.T) {
+	m := Slot{Mask: "circle", MaskInvert: true}.slotMask(20, 20, nil)
+	if c, corner := m.AlphaAt(10, 10).A, m.AlphaAt(0, 0).A; c != 0 || corner != 255 {
+		t.Errorf("inverted circle = %d in the center and %d in the corner; expected 0 and 255", c, corner)
+	}
+	m = Slot{Mask: "linear", MaskInvert: true}.slotMask(20, 20, nil)
+	if l, r := m.AlphaAt(0, 0).A, m.AlphaAt(19, 0).A; l > r {
+		t.Errorf("inverted linear mask = %d on the left and %d on the right; expected it to fade in", l, r)
+	}
+	// mask names are not case sensitive
+	if a := (Slot{Mask: "Circle"}).slotMask(20, 20, nil).AlphaAt(0, 0).A; a != 0 {
+		t.Errorf("corner of the Circle mask = %d; expected a circle", a)
+	}
+	// an image mask without an image shows the whole slot
+	m = Slot{Mask: "image"}.slotMask(4, 4, nil)
+	if a := m.AlphaAt(2, 2).A; a != 255 {
+		t.Errorf("image mask without an image = %d; expected opaque", a)
+	}
+}
+
+func Test_MakeMask_AntiAliased(t *testing.T) {
+	// a small circle covers close to its area, spread over partly covered edge pixels
+	m := MakeMask("circle", 12, 12, 0)
+	sum, partial := 0.0, 0
+	for _, a := range m.Pix {
+		sum += float64(a) / 255
+		if a > 0 && a < 255 {
+			partial++
+		}
+	}
+	if area := math.Pi * 6 * 6; math.Abs(sum-area) > area*0.01 {
+		t.Errorf("circle mask covers %.1f pixels; expected about %.1f", sum, area)
+	}
+	if partial < 20 {
+		t.Errorf("circle mask has %d partly covered pixels; expected a smooth edge", partial)
+	}
+	// pixels the same distance from the center are covered the same
+	if a, b := m.AlphaAt(0, 5).A, m.AlphaAt(5, 0).A; a != b {
+		t.Errorf("circle edge pixels = %d and %d; expected them equal", a, b)
+	}
+}
+
+func Test_FeatherMask(t *testing.T) {
+	sharp := MakeMask("circle", 40, 40, 0)
+	soft := Slot{Mask: "circle", MaskFeather: 8}.slotMask(40, 40, nil)
+	if a := soft.AlphaAt(20, 20).A; a != 255 {
+		t.Errorf("center of the feathered circle = %d; expected opaque", a)
+	}
+	// the edge at x 0 fades in on both sides
+	if in, out := soft.AlphaAt(3, 20).A, soft.AlphaAt(20, 0).A; in >= sharp.AlphaAt(3, 20).A || in == 0 {
+		t.Errorf("feathered pixel inside the edge = %d; expected between 0 and %d", in, sharp.AlphaAt(3, 20).A)
+	} else if out == 0 || out >= in {
+		t.Errorf("feathered edge pixel = %d; expected partly covered", out)
+	}
+	if a := soft.AlphaAt(0, 0).A; a > 16 {
+		t.Errorf("corner of the feathered circle = %d; expected nearly transparent", a)
+	}
+
+	// a feathered slot without a mask fades at its edges
+	soft = Slot{MaskFeather: 6}.slotMask(40, 40, nil)
+	if edge, center := soft.AlphaAt(0, 20).A, soft.AlphaAt(20, 20).A; edge > 160 || center != 255 {
+		t.Errorf("feathered slot = %d at the edge and %d in the center; expected a fade and opaque", edge, center)
+	}
+	// no feather leaves the mask as it is
+	FeatherMask(sharp, 0)
+	if !bytes.Equal(sharp.Pix, MakeMask("circle", 40, 40, 0).Pix) {
+		t.Errorf("feather of 0 changed the mask")
+	}
+}
+
+func Test_Render_MaskImage(t *testing.T) {
+	base := solidImage(10, 10, color.RGBA{0, 0, 255, 255})
+	loader := func(path string) (image.Image, error) {
+		switch path {
+		case "photo.png":
+			return solidImage(10, 10, color.RGBA{255, 255, 255, 255}), nil
+		case "stroke.png":
+			// black on the left hides the slot, white on the right shows it
+			img := solidImage(2, 2, color.RGBA{255, 255, 255, 255})
+			img.SetRGBA(0, 0, color.RGBA{0, 0, 0, 255})
+			img.SetRGBA(0, 1, color.RGBA{0, 0, 0, 255})
+			return img, nil
+		}
+		return nil, errors.New("not found")
+	}
+	render := func(slot Slot) (*image.RGBA, *Report) {
+		slot.ID, slot.Width, slot.Height, slot.Mask = "photo", 10, 10, "image"
+		img, report, err := Render(context.Background(), &Template{Slots: []Slot{slot}}, Inputs{"photo": "photo.png"},
+			WithBaseImage(base), WithImageLoader(loader))
+		if err != nil {
+			t.Fatalf("Render returned error: %v", err)
+		}
+		return img.(*image.RGBA), report
+	}
+
+	img, _ := render(Slot{MaskImage: "stroke.png"})
+	if l, r := img.RGBAAt(0, 5), img.RGBAAt(9, 5); l.R != 0 || r.R != 255 {
+		t.Errorf("masked slot is %v on the left and %v on the right; expected the base then the slot", l, r)
+	}
+	img, _ = render(Slot{MaskImage: "stroke.png", MaskInvert: true})
+	if l, r := img.RGBAAt(0, 5), img.RGBAAt(9, 5); l.R != 255 || r.R != 0 {
+		t.Errorf("inverted masked slot is %v on the left and %v on the right; expected the slot then the base", l, r)
+	}
+
+	_, report := render(Slot{MaskImage: "missing.png"})
+	if sr := report.Slots[0]; sr.Status != SlotImageLoadFailed || sr.Err == nil {
+		t.Errorf("missing mask image reported %s, %v; expected %s", sr.Status, sr.Err, SlotImageLoadFailed)
+	}
+}
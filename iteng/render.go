@@ -0,0 +1,330 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fogleman/gg"
+)
+
+// ImageLoader loads the image for a path, either the template image
+// or the value of an image slot input
+type ImageLoader func(path string) (image.Image, error)
+
+// Option configures a call to Render
+type Option func(*renderOptions)
+
+type renderOptions struct {
+	baseImage   image.Image
+	imageLoader ImageLoader
+	strict      bool
+	fonts       *FontRegistry
+}
+
+// WithBaseImage uses img as the base image instead of loading Template.TemplateImage
+func WithBaseImage(img image.Image) Option {
+	return func(o *renderOptions) {
+		o.baseImage = img
+	}
+}
+
+// WithImageLoader replaces LoadImageFromFile for resolving image paths.
+// Useful when the images are held in memory or fetched from a store.
+func WithImageLoader(loader ImageLoader) Option {
+	return func(o *renderOptions) {
+		o.imageLoader = loader
+	}
+}
+
+// WithFontRegistry resolves and caches text slot fonts in fonts
+// instead of DefaultFontRegistry
+func WithFontRegistry(fonts *FontRegistry) Option {
+	return func(o *renderOptions) {
+		o.fonts = fonts
+	}
+}
+
+// WithStrict fails the render instead of degrading the output.
+// Render then returns a *DegradedError for the first slot that is missing
+// its input, fails to load its image or falls back from its requested font,
+// and an *UnknownInputError for inputs that match no slot.
+func WithStrict() Option {
+	return func(o *renderOptions) {
+		o.strict = true
+	}
+}
+
+func newRenderOptions(opts []Option) *renderOptions {
+	o := &renderOptions{
+		imageLoader: LoadImageFromFile,
+		fonts:       DefaultFontRegistry,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Render composites the inputs into the template and returns the resulting canvas.
+// Nothing is written to disk. Rendering stops with ctx.Err() once ctx is done.
+// The Report lists the outcome of every slot; on error it covers the slots
+// processed before the error.
+func Render(ctx context.Context, tmpl *Template, inputs Inputs, opts ...Option) (image.Image, *Report, error) {
+	start := time.Now()
+	report := &Report{}
+	defer func() {
+		report.Total = time.Since(start)
+	}()
+
+	if tmpl == nil {
+		return nil, report, fmt.Errorf("nil template")
+	}
+	o := newRenderOptions(opts)
+
+	if err := ctx.Err(); err != nil {
+		return nil, report, err
+	}
+
+	if o.strict {
+		if err := checkInputs(tmpl, inputs); err != nil {
+			return nil, report, err
+		}
+	}
+
+	baseImg := o.baseImage
+	if baseImg == nil {
+		var err error
+		baseImg, err = o.imageLoader(tmpl.TemplateImage)
+		if err != nil {
+			return nil, report, fmt.Errorf("loading base image: %v", err)
+		}
+	}
+
+	var canvas *image.RGBA
+	if tmpl.Output.Width > 0 && tmpl.Output.Height > 0 {
+		canvas = image.NewRGBA(image.Rect(0, 0, tmpl.Output.Width, tmpl.Output.Height))
+		// draw scaled base to fill canvas
+		scaledBase, err := ResizeImageContext(ctx, baseImg, tmpl.Output.Width, tmpl.Output.Height, ResizeModeFill)
+		if err != nil {
+			return nil, report, err
+		}
+		draw.Draw(canvas, canvas.Bounds(), scaledBase, image.Point{0, 0}, draw.Src)
+	} else {
+		b := baseImg.Bounds()
+		canvas = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(canvas, canvas.Bounds(), baseImg, b.Min, draw.Src)
+	}
+	if len(tmpl.Filters) > 0 {
+		filtered, err := applyFiltersContext(ctx, canvas, tmpl.Filters)
+		if err != nil {
+			return nil, report, err
+		}
+		draw.Draw(canvas, canvas.Bounds(), filtered, image.Point{0, 0}, draw.Src)
+	}
+	report.BaseImage = time.Since(start)
+
+	dc := gg.NewContextForRGBA(canvas)
+
+	// Process slots
+	for _, slot := range tmpl.Slots {
+		if err := ctx.Err(); err != nil {
+			return nil, report, err
+		}
+
+		slotStart := time.Now()
+		sr, err := o.renderSlot(ctx, dc, canvas, slot, inputs)
+		if err != nil {
+			return nil, report, err
+		}
+		report.addSlot(sr, slotStart)
+
+		if o.strict && sr.Degraded() {
+			return nil, report, &DegradedError{SlotID: sr.ID, Status: sr.Status, Err: sr.Err}
+		}
+	}
+
+	return canvas, report, nil
+}
+
+// RenderTo renders the template and encodes the result to w using the
+// template's output format, or png when none is set
+func RenderTo(ctx context.Context, w io.Writer, tmpl *Template, inputs Inputs, opts ...Option) (*Report, error) {
+	start := time.Now()
+	img, report, err := Render(ctx, tmpl, inputs, opts...)
+	if err != nil {
+		return report, err
+	}
+	format := tmpl.Output.Format
+	if format == "" {
+		format = "png"
+	}
+
+	encStart := time.Now()
+	err = EncodeImageContext(ctx, w, img, format)
+	report.Encode = time.Since(encStart)
+	report.Total = time.Since(start)
+	return report, err
+}
+
+// renderSlot draws a single slot and reports its outcome.
+// Only context errors are returned, other failures degrade the slot.
+func (o *renderOptions) renderSlot(ctx context.Context, dc *gg.Context, canvas *image.RGBA, slot Slot, inputs Inputs) (SlotReport, error) {
+	sr := SlotReport{ID: slot.ID, Status: SlotRendered}
+
+	val, ok := inputs[slot.ID]
+	if !ok {
+		sr.Status = SlotMissingInput
+		sr.Err = fmt.Errorf("no input for slot %s", slot.ID)
+		return sr, nil
+	}
+
+	if slot.IsText {
+		// draw text in slot
+		res, err := slot.drawText(ctx, dc, o.fonts, val)
+		if err != nil {
+			return sr, err
+		}
+		sr.Font = res.Font
+		sr.FontSize = res.FontSize
+		sr.Truncated = res.Truncated
+		sr.Bounds = newBounds(res.Bounds)
+		switch {
+		case res.MarkupErr != nil:
+			sr.Status = SlotInvalidMarkup
+			sr.Err = res.MarkupErr
+		case res.FontFallback:
+			sr.Status = SlotFontFallback
+			sr.Err = res.FontErr
+		}
+		return sr, nil
+	}
+
+	// load image
+	img, err := o.imageLoader(val)
+	if err != nil {
+		sr.Status = SlotImageLoadFailed
+		sr.Err = err
+		return sr, nil
+	}
+
+	// the focal point of the image can be given with the input
+	if focus, ok := inputs[slot.ID+FocusInputSuffix]; ok {
+		fx, fy, err := parseFocus(focus)
+		if err != nil {
+			sr.Status = SlotInvalidInput
+			sr.Err = err
+		} else {
+			slot.FocusX, slot.FocusY = Float(fx), Float(fy)
+		}
+	}
+
+	if err := slot.checkSkew(); err != nil {
+		sr.Status = SlotInvalidTransform
+		sr.Err = err
+	}
+
+	var maskImg image.Image
+	if strings.EqualFold(slot.Mask, "image") && slot.MaskImage != "" {
+		maskImg, err = o.imageLoader(slot.MaskImage)
+		if err != nil {
+			sr.Status = SlotImageLoadFailed
+			sr.Err = fmt.Errorf("loading mask image: %v", err)
+			return sr, nil
+		}
+	}
+
+	bounds, err := slot.drawImageInto(ctx, canvas, img, maskImg)
+	if err != nil {
+		return sr, err
+	}
+	sr.Bounds = newBounds(bounds)
+	return sr, nil
+}
+
+// drawImageInto resizes img for the slot and composites it onto the canvas
+// through the slot mask, made from maskImg for image masks. It returns the
+// area of the canvas it covers.
+func (slot Slot) drawImageInto(ctx context.Context, canvas *image.RGBA, img, maskImg image.Image) (image.Rectangle, error) {
+	mode := ResizeMode(strings.ToLower(string(slot.Mode)))
+	if mode == "" {
+		mode = ResizeModeFit
+	}
+
+	// a known focal point beats guessing one from the content
+	if mode == ResizeModeSmart && (slot.FocusX != nil || slot.FocusY != nil) {
+		mode = ResizeModeCover
+	}
+
+	// the focal point is a point of the whole image, move it into the crop
+	fx, fy := slot.EffectiveFocus()
+	if slot.Crop != nil {
+		whole := img.Bounds()
+		img = CropImage(img, image.Rect(slot.Crop.X, slot.Crop.Y, slot.Crop.X+slot.Crop.Width, slot.Crop.Y+slot.Crop.Height))
+		crop := img.Bounds()
+		fx = (fx*float64(whole.Dx()) - float64(crop.Min.X-whole.Min.X)) / float64(crop.Dx())
+		fy = (fy*float64(whole.Dy()) - float64(crop.Min.Y-whole.Min.Y)) / float64(crop.Dy())
+	}
+
+	finalImg, err := resizeContext(ctx, func() image.Image {
+		return ResizeImageFocus(img, slot.Width, slot.Height, mode, fx, fy)
+	})
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	finalImg, err = applyFiltersContext(ctx, finalImg, slot.Filters)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	// If mask requested, create mask and use draw.DrawMask
+	mask := slot.slotMask(finalImg.Bounds().Dx(), finalImg.Bounds().Dy(), maskImg)
+	// apply opacity through the mask so the premultiplied colors stay consistent
+	scaleAlpha(mask, slot.EffectiveOpacity())
+
+	// compute anchor placement
+	ax, ay := slot.EffectiveAnchor()
+	ox := slot.X - int(float64(finalImg.Bounds().Dx())*ax)
+	oy := slot.Y - int(float64(finalImg.Bounds().Dy())*ay)
+	dstRect := image.Rect(ox, oy, ox+finalImg.Bounds().Dx(), oy+finalImg.Bounds().Dy())
+
+	// prepare RGBA overlay
+	rgbaOverlay := image.NewRGBA(finalImg.Bounds())
+	draw.Draw(rgbaOverlay, rgbaOverlay.Bounds(), finalImg, finalImg.Bounds().Min, draw.Src)
+
+	if err := ctx.Err(); err != nil {
+		return image.Rectangle{}, err
+	}
+
+	if slot.transformed() {
+		// mask the layer first so the mask turns with the image
+		layer := image.NewRGBA(image.Rect(0, 0, dstRect.Dx(), dstRect.Dy()))
+		draw.DrawMask(layer, layer.Bounds(), rgbaOverlay, rgbaOverlay.Bounds().Min, mask, image.Point{0, 0}, draw.Over)
+		m := slot.layerTransform(layer.Bounds().Dx(), layer.Bounds().Dy())
+		out := transformLayer(layer, m, canvas.Bounds().Inset(-transformPad))
+		DrawBlend(canvas, out.Bounds(), out, out.Bounds().Min, nil, image.Point{}, slot.BlendMode)
+		return affineBounds(m, layer.Bounds()), nil
+	}
+
+	// draw with mask
+	DrawBlend(canvas, dstRect, rgbaOverlay, rgbaOverlay.Bounds().Min, mask, image.Point{0, 0}, slot.BlendMode)
+	return dstRect, nil
+}
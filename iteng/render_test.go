@@ -0,0 +1,228 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func solidImage(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func Test_Render_InMemory(t *testing.T) {
+	base := solidImage(40, 30, color.RGBA{0, 0, 255, 255})
+	overlay := solidImage(10, 10, color.RGBA{255, 0, 0, 255})
+
+	tmpl := &Template{
+		Slots: []Slot{
+			{ID: "logo", X: 5, Y: 5, Width: 10, Height: 10},
+		},
+	}
+	inputs := Inputs{"logo": "mem://logo"}
+
+	loader := func(path string) (image.Image, error) {
+		if path != "mem://logo" {
+			t.Errorf("unexpected image path %q", path)
+		}
+		return overlay, nil
+	}
+
+	img, _, err := Render(context.Background(), tmpl, inputs, WithBaseImage(base), WithImageLoader(loader))
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if img.Bounds().Dx() != 40 || img.Bounds().Dy() != 30 {
+		t.Errorf("Render dimensions incorrect: got %dx%d, expected 40x30", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+
+	r, _, b, _ := img.At(8, 8).RGBA()
+	if r>>8 != 255 || b>>8 != 0 {
+		t.Errorf("pixel (8,8) should be covered by the red slot: got r=%d b=%d", r>>8, b>>8)
+	}
+	r, _, b, _ = img.At(30, 20).RGBA()
+	if r>>8 != 0 || b>>8 != 255 {
+		t.Errorf("pixel (30,20) should show the blue base: got r=%d b=%d", r>>8, b>>8)
+	}
+}
+
+func Test_Render_OutputSize(t *testing.T) {
+	tmpl := &Template{Output: Output{Width: 64, Height: 48}}
+
+	img, _, err := Render(context.Background(), tmpl, Inputs{}, WithBaseImage(solidImage(10, 10, color.RGBA{1, 2, 3, 255})))
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+		t.Errorf("Render dimensions incorrect: got %dx%d, expected 64x48", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+}
+
+func Test_Render_MissingBaseImage(t *testing.T) {
+	tmpl := &Template{TemplateImage: "non-existant-file.png"}
+	if _, _, err := Render(context.Background(), tmpl, Inputs{}); err == nil {
+		t.Errorf("Render should have returned an error for a missing base image")
+	}
+}
+
+func Test_RenderTo_EncodesPNG(t *testing.T) {
+	tmpl := &Template{}
+	base := solidImage(20, 10, color.RGBA{0, 255, 0, 255})
+
+	var buf bytes.Buffer
+	if _, err := RenderTo(context.Background(), &buf, tmpl, Inputs{}, WithBaseImage(base)); err != nil {
+		t.Fatalf("RenderTo returned error: %v", err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("RenderTo output is not a png: %v", err)
+	}
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 10 {
+		t.Errorf("RenderTo dimensions incorrect: got %dx%d, expected 20x10", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+}
+
+func Test_Render_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tmpl := &Template{}
+	_, _, err := Render(ctx, tmpl, Inputs{}, WithBaseImage(solidImage(10, 10, color.RGBA{0, 0, 0, 255})))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Render with cancelled context returned %v; expected %v", err, context.Canceled)
+	}
+}
+
+func Test_Render_FontDownloadDeadline(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	tmpl := &Template{
+		Slots: []Slot{
+			{ID: "title", X: 0, Y: 0, Width: 50, Height: 20, IsText: true,
+				TextOpts: TextOpt{FontSource: "url", FontURL: srv.URL + "/font.ttf", FontSize: 12}},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := Render(ctx, tmpl, Inputs{"title": "slow"}, WithBaseImage(solidImage(50, 20, color.RGBA{0, 0, 0, 255})))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Render returned %v; expected %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Render took %v to honour the deadline", elapsed)
+	}
+}
+
+func Test_RenderTo_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	_, err := RenderTo(ctx, &buf, &Template{}, Inputs{}, WithBaseImage(solidImage(10, 10, color.RGBA{0, 0, 0, 255})))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("RenderTo with cancelled context returned %v; expected %v", err, context.Canceled)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("RenderTo with cancelled context wrote %d bytes", buf.Len())
+	}
+}
+
+func Test_Render_ExplicitZeroOpacity(t *testing.T) {
+	base := solidImage(20, 20, color.RGBA{0, 0, 255, 255})
+	loader := func(path string) (image.Image, error) {
+		return solidImage(10, 10, color.RGBA{255, 0, 0, 255}), nil
+	}
+	tmpl := &Template{
+		Slots: []Slot{{ID: "logo", Width: 10, Height: 10, Opacity: Float(0)}},
+	}
+
+	img, _, err := Render(context.Background(), tmpl, Inputs{"logo": "logo.png"}, WithBaseImage(base), WithImageLoader(loader))
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if r, _, b, _ := img.At(5, 5).RGBA(); r>>8 != 0 || b>>8 != 255 {
+		t.Errorf("slot with opacity 0 should be invisible: got r=%d b=%d", r>>8, b>>8)
+	}
+}
+
+func Test_Render_CropAndFocus(t *testing.T) {
+	base := solidImage(10, 10, color.RGBA{0, 0, 255, 255})
+	loader := func(path string) (image.Image, error) {
+		return halvesImage(40, 10), nil
+	}
+	render := func(slot Slot, inputs Inputs) (image.Image, *Report) {
+		slot.ID, slot.Width, slot.Height, slot.Mode = "photo", 10, 10, ResizeModeCover
+		inputs["photo"] = "photo.png"
+		img, report, err := Render(context.Background(), &Template{Slots: []Slot{slot}}, inputs, WithBaseImage(base), WithImageLoader(loader))
+		if err != nil {
+			t.Fatalf("Render returned error: %v", err)
+		}
+		return img, report
+	}
+	isGreen := func(img image.Image) bool {
+		r, g, _, _ := img.At(1, 5).RGBA()
+		return r>>8 == 0 && g>>8 == 255
+	}
+
+	// the focal point is of the whole image, here in the green half
+	if img, _ := render(Slot{Crop: &Crop{Width: 30, Height: 10}, FocusX: Float(0.75)}, Inputs{}); !isGreen(img) {
+		t.Errorf("crop around the focal point is not green")
+	}
+	if img, _ := render(Slot{Crop: &Crop{X: 25, Width: 10, Height: 10}, Mode: ResizeModeFill}, Inputs{}); !isGreen(img) {
+		t.Errorf("crop of the green half is not green")
+	}
+
+	// the input overrides the template focus
+	if img, _ := render(Slot{FocusX: Float(0)}, Inputs{"photo.focus": "1, 0.5"}); !isGreen(img) {
+		t.Errorf("focus input was not applied")
+	}
+	img, report := render(Slot{FocusX: Float(0)}, Inputs{"photo.focus": "right"})
+	if isGreen(img) || report.Slots[0].Status != SlotInvalidInput {
+		t.Errorf("invalid focus input reported %s; expected %s and the template focus", report.Slots[0].Status, SlotInvalidInput)
+	}
+
+	// strict renders accept the focus input of image slots only
+	tmpl := &Template{Slots: []Slot{{ID: "photo"}, {ID: "title", IsText: true}}}
+	_, _, err := Render(context.Background(), tmpl, Inputs{"photo": "photo.png", "photo.focus": "0.5,0.5", "title": "x", "title.focus": "0.5,0.5"},
+		WithBaseImage(base), WithImageLoader(loader), WithStrict())
+	var ue *UnknownInputError
+	if !errors.As(err, &ue) || len(ue.Keys) != 1 || ue.Keys[0] != "title.focus" {
+		t.Errorf("strict Render returned %v; expected title.focus to be unknown", err)
+	}
+}
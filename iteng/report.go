@@ -0,0 +1,162 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SlotStatus is the outcome of rendering a single Slot
+type SlotStatus string
+
+// rendered - the slot was drawn as requested
+// missing_input - the Inputs had no value for the slot so it was skipped
+// image_load_failed - the slot image could not be loaded so it was skipped
+// font_fallback - the text was drawn with a fallback font instead of the requested font
+// invalid_markup - the text markup could not be parsed so the text was drawn without its tags
+// invalid_input - a companion input such as "<slot id>.focus" could not be parsed so the slot was drawn without it
+// invalid_transform - the slot skew was not between -90 and 90 degrees so the slot was drawn without it
+const (
+	SlotRendered         SlotStatus = "rendered"
+	SlotMissingInput     SlotStatus = "missing_input"
+	SlotImageLoadFailed  SlotStatus = "image_load_failed"
+	SlotFontFallback     SlotStatus = "font_fallback"
+	SlotInvalidMarkup    SlotStatus = "invalid_markup"
+	SlotInvalidInput     SlotStatus = "invalid_input"
+	SlotInvalidTransform SlotStatus = "invalid_transform"
+)
+
+// SlotReport records what happened to one Slot during Render
+type SlotReport struct {
+	ID     string     `json:"id"`
+	Status SlotStatus `json:"status"`
+	// Err is why the slot was degraded, nil when it was rendered
+	Err error `json:"-"`
+	// Message is Err as text so the report can be marshalled
+	Message string `json:"message,omitempty"`
+	// Font is the resolved font for text slots, e.g. "file:fonts/title.ttf" or DefaultFont
+	Font string `json:"font,omitempty"`
+	// FontSize is the size text slots were drawn at, see TextOpt.Fit
+	FontSize float64 `json:"font_size,omitempty"`
+	// Truncated is set when text was cut short, see TextOpt.MaxLines
+	Truncated bool `json:"truncated,omitempty"`
+	// Bounds is the area of the output the slot covers after its transform,
+	// for text slots the box the text was laid out in
+	Bounds   *Bounds       `json:"bounds,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Bounds is a rectangle on the output image in pixels
+type Bounds struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// newBounds returns the Bounds of r
+func newBounds(r image.Rectangle) *Bounds {
+	return &Bounds{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// Degraded reports whether the slot was not rendered as requested
+func (sr SlotReport) Degraded() bool {
+	return sr.Status != SlotRendered
+}
+
+// Report describes a call to Render
+type Report struct {
+	// Slots has an entry per template slot, in template order
+	Slots []SlotReport `json:"slots"`
+	// BaseImage is the time spent loading and scaling the base image
+	BaseImage time.Duration `json:"base_image"`
+	// Encode is the time spent encoding the output, zero for Render
+	Encode time.Duration `json:"encode,omitempty"`
+	// Total is the time spent in the call
+	Total time.Duration `json:"total"`
+}
+
+// Degraded returns the reports of the slots that were not rendered as requested
+func (r *Report) Degraded() []SlotReport {
+	var out []SlotReport
+	for _, sr := range r.Slots {
+		if sr.Degraded() {
+			out = append(out, sr)
+		}
+	}
+	return out
+}
+
+func (r *Report) addSlot(sr SlotReport, start time.Time) {
+	if sr.Err != nil {
+		sr.Message = sr.Err.Error()
+	}
+	sr.Duration = time.Since(start)
+	r.Slots = append(r.Slots, sr)
+}
+
+// DegradedError is returned by a strict Render when a slot
+// could not be rendered as requested
+type DegradedError struct {
+	SlotID string
+	Status SlotStatus
+	Err    error
+}
+
+func (e *DegradedError) Error() string {
+	return fmt.Sprintf("slot %s: %s: %v", e.SlotID, e.Status, e.Err)
+}
+
+func (e *DegradedError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownInputError is returned by a strict Render when
+// Inputs has keys that match no Slot.ID
+type UnknownInputError struct {
+	Keys []string
+}
+
+func (e *UnknownInputError) Error() string {
+	return fmt.Sprintf("inputs match no slot: %s", strings.Join(e.Keys, ", "))
+}
+
+// checkInputs returns an *UnknownInputError if inputs has keys for slots the
+// template lacks, or a focus for a slot that is not an image slot
+func checkInputs(tmpl *Template, inputs Inputs) error {
+	ids := make(map[string]bool, len(tmpl.Slots))
+	for _, slot := range tmpl.Slots {
+		ids[slot.ID] = true
+		if !slot.IsText {
+			ids[slot.ID+FocusInputSuffix] = true
+		}
+	}
+
+	var unknown []string
+	for key := range inputs {
+		if !ids[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return &UnknownInputError{Keys: unknown}
+}
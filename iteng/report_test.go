@@ -0,0 +1,147 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"testing"
+)
+
+func Test_Render_Report(t *testing.T) {
+	tmpl := &Template{
+		Slots: []Slot{
+			{ID: "photo", X: 0, Y: 0, Width: 10, Height: 10, Opacity: Float(1)},
+			{ID: "missing", X: 0, Y: 0, Width: 10, Height: 10},
+			{ID: "title", X: 0, Y: 0, Width: 40, Height: 20, IsText: true,
+				TextOpts: TextOpt{FontSource: "file", FontPath: "../test/NotoSansPhoenician-Regular.ttf", FontSize: 12}},
+			{ID: "caption", X: 0, Y: 20, Width: 40, Height: 20, IsText: true,
+				TextOpts: TextOpt{FontSource: "file", FontPath: "non-existant-font.ttf", FontSize: 12}},
+		},
+	}
+	inputs := Inputs{
+		"photo":   "non-existant-file.png",
+		"title":   "Title",
+		"caption": "Caption",
+	}
+
+	_, report, err := Render(context.Background(), tmpl, inputs, WithBaseImage(solidImage(40, 40, color.RGBA{0, 0, 0, 255})))
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if len(report.Slots) != len(tmpl.Slots) {
+		t.Fatalf("report has %d slots; expected %d", len(report.Slots), len(tmpl.Slots))
+	}
+
+	expected := []SlotStatus{SlotImageLoadFailed, SlotMissingInput, SlotRendered, SlotFontFallback}
+	for i, sr := range report.Slots {
+		if sr.ID != tmpl.Slots[i].ID {
+			t.Errorf("report slot %d is %q; expected %q", i, sr.ID, tmpl.Slots[i].ID)
+		}
+		if sr.Status != expected[i] {
+			t.Errorf("slot %s status = %s; expected %s", sr.ID, sr.Status, expected[i])
+		}
+	}
+
+	if report.Slots[0].Err == nil || report.Slots[0].Message == "" {
+		t.Errorf("image load failure should carry an error")
+	}
+	if font := report.Slots[2].Font; font != "file:../test/NotoSansPhoenician-Regular.ttf" {
+		t.Errorf("title font = %q; expected the requested file", font)
+	}
+	if b := report.Slots[2].Bounds; b == nil || b.Width <= 0 || b.Height <= 0 {
+		t.Errorf("title bounds = %v; expected the drawn text box", b)
+	}
+	if font := report.Slots[3].Font; font != DefaultFont {
+		t.Errorf("caption font = %q; expected %s", font, DefaultFont)
+	}
+	if n := len(report.Degraded()); n != 3 {
+		t.Errorf("report has %d degraded slots; expected 3", n)
+	}
+	if report.Total <= 0 {
+		t.Errorf("report total duration should be set")
+	}
+}
+
+func Test_Render_Strict(t *testing.T) {
+	base := WithBaseImage(solidImage(40, 40, color.RGBA{0, 0, 0, 255}))
+	fontOpts := TextOpt{FontSource: "file", FontPath: "../test/NotoSansPhoenician-Regular.ttf", FontSize: 12}
+
+	tests := []struct {
+		name   string
+		slots  []Slot
+		inputs Inputs
+		status SlotStatus
+	}{
+		{
+			name:   "missing input",
+			slots:  []Slot{{ID: "title", IsText: true, TextOpts: fontOpts}},
+			inputs: Inputs{},
+			status: SlotMissingInput,
+		},
+		{
+			name:   "image load failed",
+			slots:  []Slot{{ID: "photo", Width: 10, Height: 10}},
+			inputs: Inputs{"photo": "non-existant-file.png"},
+			status: SlotImageLoadFailed,
+		},
+		{
+			name:   "font fallback",
+			slots:  []Slot{{ID: "title", IsText: true, TextOpts: TextOpt{FontSource: "file", FontPath: "non-existant-font.ttf", FontSize: 12}}},
+			inputs: Inputs{"title": "Title"},
+			status: SlotFontFallback,
+		},
+	}
+
+	for _, test := range tests {
+		tmpl := &Template{Slots: test.slots}
+
+		// lenient by default
+		if _, _, err := Render(context.Background(), tmpl, test.inputs, base); err != nil {
+			t.Errorf("%s: lenient Render returned error: %v", test.name, err)
+		}
+
+		_, _, err := Render(context.Background(), tmpl, test.inputs, base, WithStrict())
+		var de *DegradedError
+		if !errors.As(err, &de) {
+			t.Errorf("%s: strict Render returned %v; expected a *DegradedError", test.name, err)
+			continue
+		}
+		if de.Status != test.status {
+			t.Errorf("%s: DegradedError status = %s; expected %s", test.name, de.Status, test.status)
+		}
+	}
+
+	// all slots satisfied
+	tmpl := &Template{Slots: []Slot{{ID: "title", IsText: true, TextOpts: fontOpts}}}
+	if _, _, err := Render(context.Background(), tmpl, Inputs{"title": "Title"}, base, WithStrict()); err != nil {
+		t.Errorf("strict Render returned error for a complete render: %v", err)
+	}
+}
+
+func Test_Render_StrictUnknownInput(t *testing.T) {
+	tmpl := &Template{Slots: []Slot{{ID: "photo", Width: 10, Height: 10}}}
+	inputs := Inputs{"photo": "non-existant-file.png", "titel": "typo", "extra": "x"}
+
+	_, _, err := Render(context.Background(), tmpl, inputs, WithBaseImage(solidImage(10, 10, color.RGBA{})), WithStrict())
+	var ue *UnknownInputError
+	if !errors.As(err, &ue) {
+		t.Fatalf("strict Render returned %v; expected an *UnknownInputError", err)
+	}
+	if len(ue.Keys) != 2 || ue.Keys[0] != "extra" || ue.Keys[1] != "titel" {
+		t.Errorf("UnknownInputError keys = %v; expected [extra titel]", ue.Keys)
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+//go:generate go run ../cmd/iteng schema -o ../schema/template.schema.json
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	schemaDialect    = "https://json-schema.org/draft/2020-12/schema"
+	templateSchemaID = "https://github.com/bluelamar/image-template-engine-go/schema/template.schema.json"
+	hexColorPattern  = "^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$"
+	focusPattern     = `^\s*(0(\.\d+)?|1(\.0+)?|\.\d+)\s*,\s*(0(\.\d+)?|1(\.0+)?|\.\d+)\s*$`
+)
+
+// schemaFields holds the schema keywords for each struct field, keyed by
+// "Type.json_name". The types themselves come from the Go structs; every
+// field must have an entry with at least a description.
+// "required" is not a property keyword, it adds the field to the object's required list.
+var schemaFields = map[string]map[string]any{
+	"Template.template_image": {"description": "Path to the base image", "required": true},
+	"Template.output":         {"description": "Output image size and format"},
+	"Template.slots":          {"description": "Image and text placements on the base image"},
+	"Template.filters":        {"description": "Filters run in order over the base image after it is scaled to the output"},
+
+	"Output.width":  {"description": "Output width in pixels, the base image is stretched when width and height are set", "minimum": 0},
+	"Output.height": {"description": "Output height in pixels, the base image is stretched when width and height are set", "minimum": 0},
+	"Output.format": {"description": "Output image format", "enum": outputFormats},
+
+	"Slot.id":            {"description": "Slot id, the key of the slot's value in the inputs", "minLength": 1, "required": true},
+	"Slot.x":             {"description": "X position of the slot anchor in pixels"},
+	"Slot.y":             {"description": "Y position of the slot anchor in pixels"},
+	"Slot.width":         {"description": "Slot width in pixels", "minimum": 0},
+	"Slot.height":        {"description": "Slot height in pixels", "minimum": 0},
+	"Slot.mask":          {"description": "Mask shape applied to an image slot", "enum": maskNames},
+	"Slot.radius":        {"description": "Corner radius for the rounded mask", "minimum": 0},
+	"Slot.mask_image":    {"description": "Path of the image for the image mask, white or opaque shows the slot and black or transparent hides it"},
+	"Slot.mask_gradient": {"description": "How the linear and radial masks fade from opaque to transparent"},
+	"Slot.mask_feather":  {"description": "Pixels the mask edges are softened over with a blur, including the edges of the slot", "minimum": 0, "default": 0},
+	"Slot.mask_invert":   {"description": "Invert the mask, hiding what it shows and showing what it hides"},
+	"Slot.anchor_x":      {"description": "Horizontal anchor, 0 is left and 1 is right", "minimum": 0, "maximum": 1, "default": 0},
+	"Slot.anchor_y":      {"description": "Vertical anchor, 0 is top and 1 is bottom", "minimum": 0, "maximum": 1, "default": 0},
+	"Slot.mode":          {"description": "How an image is resized into the slot, smart covers it and crops by the image content unless a focal point is set", "enum": resizeModes},
+	"Slot.crop":          {"description": "Part of the source image to use, in pixels from its top left"},
+	"Slot.focus_x":       {"description": "Horizontal focal point of the source image that cover mode keeps in view, 0 is left and 1 is right", "minimum": 0, "maximum": 1, "default": 0.5},
+	"Slot.focus_y":       {"description": "Vertical focal point of the source image that cover mode keeps in view, 0 is top and 1 is bottom", "minimum": 0, "maximum": 1, "default": 0.5},
+	"Slot.opacity":       {"description": "Opacity of an image slot, fully opaque when omitted", "minimum": 0, "maximum": 1, "default": 1},
+	"Slot.rotation":      {"description": "Rotation in degrees clockwise around the slot anchor", "default": 0},
+	"Slot.flip_h":        {"description": "Mirror an image slot left to right, in place before it is rotated"},
+	"Slot.flip_v":        {"description": "Mirror an image slot top to bottom, in place before it is rotated"},
+	"Slot.blend_mode":    {"description": "How an image slot mixes with the canvas beneath it, as in CSS mix-blend-mode", "enum": blendModes, "default": BlendNormal},
+	"Slot.filters":       {"description": "Filters run in order over an image after it is resized and before it is masked"},
+	"Slot.skew_x":        {"description": "Degrees an image slot is slanted along x around the slot anchor, before it is rotated", "exclusiveMinimum": -90, "exclusiveMaximum": 90, "default": 0},
+	"Slot.skew_y":        {"description": "Degrees an image slot is slanted along y around the slot anchor, before it is rotated", "exclusiveMinimum": -90, "exclusiveMaximum": 90, "default": 0},
+	"Slot.is_text":       {"description": "The slot value is text rather than an image path"},
+	"Slot.text_opts":     {"description": "Text options for a text slot"},
+
+	"TextOpt.font_path":   {"description": "Font file path"},
+	"TextOpt.font_name":   {"description": "System font name, e.g. Arial"},
+	"TextOpt.font_source": {"description": "Where to load the font from, automatic when empty", "enum": fontSources},
+	"TextOpt.font_url":    {"description": "URL to download the font from", "format": "uri"},
+	"TextOpt.font_size":   {"description": "Font size in points", "minimum": 0},
+	"TextOpt.color":       {"description": "Text color as #RGB, #RRGGBB or #RRGGBBAA", "pattern": hexColorPattern},
+	"TextOpt.align_x":     {"description": "Horizontal text alignment, justify stretches wrapped lines to the wrap width", "enum": alignXValues},
+	"TextOpt.align_y":     {"description": "Vertical text alignment", "enum": alignYValues},
+	"TextOpt.wrap":        {"description": "Wrap the text at max_width, or with the block layout at the slot size"},
+	"TextOpt.max_width":   {"description": "Wrap width in pixels, with the block layout the slot width when omitted. The column length of vertical text, the slot height when omitted", "minimum": 0},
+	"TextOpt.layout":      {"description": "baseline puts a single line on the anchor as text was first drawn, block places the lines as a block against the anchor by align_x and align_y", "enum": textLayouts, "default": TextLayoutBaseline},
+	"TextOpt.fonts":       {"description": "Fallback fonts, tried in order for runes the font above has no glyph for"},
+	"TextOpt.fit": {
+		"description": "shrink draws at the largest size from max_font_size down to min_font_size that fits the slot width and height",
+		"enum":        textFitModes,
+		"default":     TextFitNone,
+	},
+	"TextOpt.min_font_size": {"description": "Smallest font size for fit", "minimum": 0, "default": defaultMinFontSize},
+	"TextOpt.max_font_size": {"description": "Largest font size for fit, font_size when omitted", "minimum": 0},
+	"TextOpt.max_lines":     {"description": "Lines after this are dropped and the last line ends with the ellipsis, 0 for no limit", "minimum": 0},
+	"TextOpt.overflow": {
+		"description": "truncate also drops lines below the slot height and shortens lines wider than the slot",
+		"enum":        textOverflowModes,
+		"default":     TextOverflowVisible,
+	},
+	"TextOpt.line_height":       {"description": "Distance between baselines as a multiple of the font height", "minimum": 0, "default": defaultLineSpacing},
+	"TextOpt.letter_spacing":    {"description": "Pixels added between letters, negative to tighten"},
+	"TextOpt.paragraph_spacing": {"description": "Pixels added between paragraphs, which are separated by newlines", "minimum": 0},
+	"TextOpt.ellipsis":          {"description": "Ends truncated text, an empty string for none", "default": defaultEllipsis},
+	"TextOpt.stroke":            {"description": "Outline around the glyphs, drawn beneath the glyph fill"},
+	"TextOpt.shadows":           {"description": "Drop shadows, drawn in order beneath the stroke and glyph fill"},
+	"TextOpt.background":        {"description": "Box sized to the text and drawn beneath it"},
+	"TextOpt.markup":            {"description": "Style parts of the text with <b>, <i>, <u>, <s>, <br> and <span font size color> tags"},
+	"TextOpt.bold_font":         {"description": "Font for <b> markup, synthesized bold when omitted"},
+	"TextOpt.italic_font":       {"description": "Font for <i> markup, synthesized italic when omitted"},
+	"TextOpt.direction": {
+		"description": "Paragraph direction, auto takes it from the first letter of each paragraph. Right to left paragraphs are aligned right unless align_x is set",
+		"enum":        textDirections,
+		"default":     TextDirectionAuto,
+	},
+	"TextOpt.writing_mode": {
+		"description": "vertical sets upright glyphs in columns that run top to bottom and stack right to left, max_width is then the column length",
+		"enum":        textWritingModes,
+		"default":     TextWritingModeHorizontal,
+	},
+	"TextOpt.shaping": {
+		"description": "opentype shapes the text with the font's OpenType tables for ligatures, joined scripts like Arabic and positioned marks",
+		"enum":        textShapings,
+		"default":     TextShapingBasic,
+	},
+
+	"Filter.type": {"description": "Filter to run", "enum": filterTypes, "required": true},
+	"Filter.amount": {
+		"description": "Strength of the filter, 0..1 for grayscale, sepia, invert and tint, a multiplier for brightness, contrast, saturation and sharpen",
+		"minimum":     0,
+		"default":     1,
+	},
+	"Filter.radius": {"description": "Blur radius in pixels for blur, and for sharpen where it defaults to 1", "minimum": 0},
+	"Filter.angle":  {"description": "Degrees the hues are turned by for hue_rotate"},
+	"Filter.color":  {"description": "Tint color as #RGB, #RRGGBB or #RRGGBBAA", "pattern": hexColorPattern, "default": "#ffffff"},
+
+	"MaskGradient.angle":    {"description": "Direction of a linear mask in degrees clockwise, 0 fades from left to right", "default": 0},
+	"MaskGradient.start":    {"description": "Position along the gradient where the fade starts, opaque before", "minimum": 0, "maximum": 1, "default": 0},
+	"MaskGradient.end":      {"description": "Position along the gradient where the fade ends, transparent after", "minimum": 0, "maximum": 1, "default": 1},
+	"MaskGradient.center_x": {"description": "Horizontal center of a radial mask, 0 is left and 1 is right", "minimum": 0, "maximum": 1, "default": 0.5},
+	"MaskGradient.center_y": {"description": "Vertical center of a radial mask, 0 is top and 1 is bottom", "minimum": 0, "maximum": 1, "default": 0.5},
+
+	"Crop.x":      {"description": "Left of the crop in source pixels", "minimum": 0},
+	"Crop.y":      {"description": "Top of the crop in source pixels", "minimum": 0},
+	"Crop.width":  {"description": "Crop width in source pixels", "exclusiveMinimum": 0, "required": true},
+	"Crop.height": {"description": "Crop height in source pixels", "exclusiveMinimum": 0, "required": true},
+
+	"TextStroke.color": {"description": "Stroke color as #RGB, #RRGGBB or #RRGGBBAA", "pattern": hexColorPattern, "default": "#000000"},
+	"TextStroke.width": {"description": "Stroke width in pixels outside the glyph edge", "minimum": 0, "maximum": maxStrokeWidth, "required": true},
+
+	"TextBackground.color":   {"description": "Box color as #RGB, #RRGGBB or #RRGGBBAA, use an alpha for a translucent box", "pattern": hexColorPattern, "default": "#000000"},
+	"TextBackground.padding": {"description": "Pixels between the text and the box edge", "minimum": 0},
+	"TextBackground.radius":  {"description": "Corner radius in pixels", "minimum": 0},
+	"TextBackground.mode": {
+		"description": "block draws one box around all the lines, lines a box around each line",
+		"enum":        textBackgrounds,
+		"default":     TextBackgroundBlock,
+	},
+
+	"TextShadow.offset_x": {"description": "Horizontal shadow offset in pixels, positive moves right"},
+	"TextShadow.offset_y": {"description": "Vertical shadow offset in pixels, positive moves down"},
+	"TextShadow.blur":     {"description": "Blur radius in pixels", "minimum": 0, "maximum": maxShadowBlur},
+	"TextShadow.color":    {"description": "Shadow color as #RGB, #RRGGBB or #RRGGBBAA", "pattern": hexColorPattern, "default": "#000000"},
+	"TextShadow.opacity":  {"description": "Shadow opacity", "minimum": 0, "maximum": 1, "default": 1},
+
+	"FontRef.source": {"description": "Where to load the font from, automatic when empty", "enum": fontSources},
+	"FontRef.path":   {"description": "Font file path"},
+	"FontRef.name":   {"description": "Registered or system font name"},
+	"FontRef.url":    {"description": "URL to download the font from", "format": "uri"},
+}
+
+// TemplateSchema returns the JSON Schema for the Template format.
+// It is generated from the Go structs, see schema/template.schema.json.
+func TemplateSchema() map[string]any {
+	defs := make(map[string]any)
+	root := objectSchema(reflect.TypeOf(Template{}), defs)
+	root["$schema"] = schemaDialect
+	root["$id"] = templateSchemaID
+	root["title"] = "Template"
+	root["$defs"] = defs
+	return root
+}
+
+// InputsSchema returns the JSON Schema for the Inputs of tmpl,
+// with a property per slot typed as either an image or text
+func InputsSchema(tmpl *Template) map[string]any {
+	props := make(map[string]any, len(tmpl.Slots))
+	for _, slot := range tmpl.Slots {
+		if slot.IsText {
+			props[slot.ID] = map[string]any{
+				"type":        "string",
+				"title":       "text",
+				"description": "Text drawn in slot " + slot.ID,
+			}
+		} else {
+			props[slot.ID] = map[string]any{
+				"type":        "string",
+				"title":       "image",
+				"description": "Path of the image drawn in slot " + slot.ID,
+			}
+			props[slot.ID+FocusInputSuffix] = map[string]any{
+				"type":        "string",
+				"title":       "focus",
+				"description": "Focal point fx,fy of the image in slot " + slot.ID + ", overrides focus_x and focus_y",
+				"pattern":     focusPattern,
+			}
+		}
+	}
+	return map[string]any{
+		"$schema":              schemaDialect,
+		"title":                "Inputs",
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// MarshalSchema encodes a schema the way it is published
+func MarshalSchema(schema map[string]any) ([]byte, error) {
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// objectSchema describes a struct type, adding nested struct types to defs
+func objectSchema(t reflect.Type, defs map[string]any) map[string]any {
+	props := make(map[string]any)
+	var required []string
+	for name, f := range jsonFields(t) {
+		prop := typeSchema(f.Type, defs)
+		for k, v := range schemaFields[t.Name()+"."+name] {
+			if k == "required" {
+				required = append(required, name)
+				continue
+			}
+			if k == "enum" {
+				// Validate ignores case, the enum lists the names for completion
+				// and the pattern accepts the other spellings
+				prop["anyOf"] = []any{
+					map[string]any{"enum": v},
+					map[string]any{"pattern": anyCasePattern(v.([]string))},
+				}
+				continue
+			}
+			prop[k] = v
+		}
+		props[name] = prop
+	}
+
+	s := map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+// anyCasePattern matches any of values ignoring case, JSON Schema patterns
+// have no case insensitive flag so each letter becomes a [xX] class
+func anyCasePattern(values []string) string {
+	alts := make([]string, len(values))
+	for i, v := range values {
+		var b strings.Builder
+		for _, r := range v {
+			if upper, lower := unicode.ToUpper(r), unicode.ToLower(r); upper != lower {
+				b.WriteString("[" + string(lower) + string(upper) + "]")
+			} else {
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		alts[i] = b.String()
+	}
+	return "^(" + strings.Join(alts, "|") + ")$"
+}
+
+// typeSchema describes a field type, referring to struct types through $defs
+func typeSchema(t reflect.Type, defs map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // guard against recursive types
+			defs[t.Name()] = objectSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	}
+	return map[string]any{}
+}
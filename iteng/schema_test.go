@@ -0,0 +1,195 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// schemaTypes are the structs described by the template schema
+var schemaTypes = []reflect.Type{
+	reflect.TypeOf(Template{}),
+	reflect.TypeOf(Output{}),
+	reflect.TypeOf(Slot{}),
+	reflect.TypeOf(TextOpt{}),
+	reflect.TypeOf(Crop{}),
+	reflect.TypeOf(MaskGradient{}),
+	reflect.TypeOf(Filter{}),
+	reflect.TypeOf(FontRef{}),
+	reflect.TypeOf(TextStroke{}),
+	reflect.TypeOf(TextShadow{}),
+	reflect.TypeOf(TextBackground{}),
+}
+
+func TestTemplateSchema_UpToDate(t *testing.T) {
+	published, err := os.ReadFile("../schema/template.schema.json")
+	if err != nil {
+		t.Fatalf("reading published schema: %v", err)
+	}
+	generated, err := MarshalSchema(TemplateSchema())
+	if err != nil {
+		t.Fatalf("MarshalSchema returned error: %v", err)
+	}
+	if !bytes.Equal(published, generated) {
+		t.Errorf("schema/template.schema.json is out of date with the Go structs, run: go generate ./iteng")
+	}
+}
+
+func TestTemplateSchema_FieldsDescribed(t *testing.T) {
+	known := make(map[string]bool)
+	for _, typ := range schemaTypes {
+		for name := range jsonFields(typ) {
+			key := typ.Name() + "." + name
+			known[key] = true
+			if _, ok := schemaFields[key]["description"]; !ok {
+				t.Errorf("schemaFields has no description for %s", key)
+			}
+		}
+	}
+	for key := range schemaFields {
+		if !known[key] {
+			t.Errorf("schemaFields has an entry for %s which is not a field", key)
+		}
+	}
+}
+
+func TestTemplateSchema_Defs(t *testing.T) {
+	s := TemplateSchema()
+	defs := s["$defs"].(map[string]any)
+	for _, typ := range schemaTypes[1:] {
+		if _, ok := defs[typ.Name()]; !ok {
+			t.Errorf("schema $defs is missing %s", typ.Name())
+		}
+	}
+	required := s["required"].([]string)
+	if len(required) != 1 || required[0] != "template_image" {
+		t.Errorf("template schema required = %v; expected [template_image]", required)
+	}
+}
+
+// enumFixtures set each enum field of the template schema on a valid
+// template, with the path Validate reports the field's problems at
+var enumFixtures = map[string]struct {
+	path string
+	set  func(tmpl *Template, v string)
+}{
+	"Output.format":        {"output.format", func(tmpl *Template, v string) { tmpl.Output.Format = v }},
+	"Slot.mask":            {"slots[0].mask", func(tmpl *Template, v string) { tmpl.Slots[0].Mask = v }},
+	"Slot.mode":            {"slots[0].mode", func(tmpl *Template, v string) { tmpl.Slots[0].Mode = ResizeMode(v) }},
+	"Slot.blend_mode":      {"slots[0].blend_mode", func(tmpl *Template, v string) { tmpl.Slots[0].BlendMode = BlendMode(v) }},
+	"Filter.type":          {"filters[0].type", func(tmpl *Template, v string) { tmpl.Filters[0].Type = v }},
+	"TextOpt.font_source":  {"slots[1].text_opts.font_source", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.FontSource = v }},
+	"TextOpt.align_x":      {"slots[1].text_opts.align_x", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.AlignX = v }},
+	"TextOpt.align_y":      {"slots[1].text_opts.align_y", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.AlignY = v }},
+	"TextOpt.layout":       {"slots[1].text_opts.layout", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.Layout = v }},
+	"TextOpt.fit":          {"slots[1].text_opts.fit", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.Fit = v }},
+	"TextOpt.overflow":     {"slots[1].text_opts.overflow", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.Overflow = v }},
+	"TextOpt.direction":    {"slots[1].text_opts.direction", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.Direction = v }},
+	"TextOpt.writing_mode": {"slots[1].text_opts.writing_mode", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.WritingMode = v }},
+	"TextOpt.shaping":      {"slots[1].text_opts.shaping", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.Shaping = v }},
+	"TextBackground.mode":  {"slots[1].text_opts.background.mode", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.Background.Mode = v }},
+	"FontRef.source":       {"slots[1].text_opts.fonts[0].source", func(tmpl *Template, v string) { tmpl.Slots[1].TextOpts.Fonts[0].Source = v }},
+}
+
+// schemaAccepts checks v against the enum, pattern and anyOf keywords of s,
+// the keywords the schema describes enum fields with
+func schemaAccepts(s map[string]any, v string) bool {
+	if enum, ok := s["enum"].([]string); ok && !slices.Contains(enum, v) {
+		return false
+	}
+	if p, ok := s["pattern"].(string); ok && !regexp.MustCompile(p).MatchString(v) {
+		return false
+	}
+	if subs, ok := s["anyOf"].([]any); ok {
+		return slices.ContainsFunc(subs, func(sub any) bool { return schemaAccepts(sub.(map[string]any), v) })
+	}
+	return true
+}
+
+func TestTemplateSchema_EnumsMatchValidate(t *testing.T) {
+	defs := TemplateSchema()["$defs"].(map[string]any)
+	for key, fields := range schemaFields {
+		values, ok := fields["enum"].([]string)
+		if !ok {
+			continue
+		}
+		fixture, ok := enumFixtures[key]
+		if !ok {
+			t.Errorf("enumFixtures has no fixture for %s", key)
+			continue
+		}
+		typ, name, _ := strings.Cut(key, ".")
+		prop := defs[typ].(map[string]any)["properties"].(map[string]any)[name].(map[string]any)
+
+		var fixtures []string
+		for _, v := range values {
+			fixtures = append(fixtures, v, strings.ToUpper(v), strings.ToUpper(v[:1])+v[1:])
+		}
+		fixtures = append(fixtures, "bogus", values[0]+"x", " "+values[0])
+		for _, v := range fixtures {
+			tmpl := &Template{
+				TemplateImage: "../test/sun_and_moon_100x100.png",
+				Filters:       []Filter{{Type: FilterGrayscale}},
+				Slots: []Slot{
+					{ID: "photo", Width: 10, Height: 10},
+					{ID: "title", IsText: true, Width: 100, Height: 20, TextOpts: TextOpt{Background: &TextBackground{}, Fonts: []FontRef{{Name: DefaultFont}}}},
+				},
+			}
+			fixture.set(tmpl, v)
+			valid := !hasPath(Validate(tmpl), fixture.path)
+			if accepted := schemaAccepts(prop, v); accepted != valid {
+				t.Errorf("%s %q: schema accepts it %v, Validate accepts it %v", key, v, accepted, valid)
+			}
+		}
+	}
+}
+
+func TestInputsSchema(t *testing.T) {
+	tmpl, err := ParseTemplate("../test/test_template.json")
+	if err != nil {
+		t.Fatalf("ParseTemplate failed with error: %v", err)
+	}
+
+	props := InputsSchema(tmpl)["properties"].(map[string]any)
+	expected := len(tmpl.Slots)
+	for _, slot := range tmpl.Slots {
+		if !slot.IsText {
+			expected++ // the focus input
+		}
+	}
+	if len(props) != expected {
+		t.Errorf("inputs schema has %d properties; expected %d", len(props), expected)
+	}
+	if kind := props["motif"].(map[string]any)["title"]; kind != "image" {
+		t.Errorf("motif is typed %v; expected image", kind)
+	}
+	if kind := props["motif.focus"].(map[string]any)["title"]; kind != "focus" {
+		t.Errorf("motif.focus is typed %v; expected focus", kind)
+	}
+	if kind := props["title"].(map[string]any)["title"]; kind != "text" {
+		t.Errorf("title is typed %v; expected text", kind)
+	}
+
+	b, err := MarshalSchema(InputsSchema(tmpl))
+	if err != nil || !strings.Contains(string(b), `"additionalProperties": false`) {
+		t.Errorf("MarshalSchema(InputsSchema) = %s, %v", b, err)
+	}
+}
@@ -0,0 +1,407 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/fogleman/gg"
+	"github.com/go-text/typesetting/di"
+	gtfont "github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/bidi"
+)
+
+// Text directions for TextOpt.Direction
+// auto - each paragraph takes the direction of its first letter, left to right when it has none
+// ltr - left to right
+// rtl - right to left
+const (
+	TextDirectionAuto = "auto"
+	TextDirectionLTR  = "ltr"
+	TextDirectionRTL  = "rtl"
+)
+
+// Text shaping for TextOpt.Shaping
+// basic - draw the glyph of each rune in turn
+// opentype - shape runs with the font's OpenType tables, for ligatures,
+// contextual forms and mark positioning
+const (
+	TextShapingBasic    = "basic"
+	TextShapingOpenType = "opentype"
+)
+
+// textShaper puts the runs of each line in visual order with the Unicode
+// bidi algorithm and, for TextShapingOpenType, shapes them into glyphs.
+// A nil textShaper lays text out left to right rune by rune.
+// It is not safe for concurrent use.
+type textShaper struct {
+	// dir is the TextOpt.Direction of every paragraph
+	dir      string
+	opentype bool
+	// vertical text is drawn rune by rune in columns, without bidi ordering
+	vertical bool
+
+	hb  shaping.HarfbuzzShaper
+	seg shaping.Segmenter
+	buf sfnt.Buffer
+	// faces holds the shaping faces of each registry font, nil for fonts that failed to parse
+	faces map[string]*shapingFace
+	// shaped caches shaped runs, which are measured many times while wrapping and fitting
+	shaped map[shapeKey][]shapedRun
+}
+
+// shapingFace is a font as the shaper sees it and the font its glyphs are drawn from
+type shapingFace struct {
+	face     *gtfont.Face
+	outlines *sfnt.Font
+}
+
+type shapeKey struct {
+	style *textStyle
+	size  float64
+	text  string
+	rtl   bool
+}
+
+// shapedRun is text in one font and direction shaped into glyphs in visual order
+type shapedRun struct {
+	out      shaping.Output
+	outlines *sfnt.Font
+	text     []rune
+	// scale converts the shaped metrics, shaped at a whole pixel size, to the font size
+	scale float64
+}
+
+// newTextShaper returns the shaper for the direction and shaping of opts
+func newTextShaper(opts TextOpt) *textShaper {
+	dir := strings.ToLower(opts.Direction)
+	if dir == "" {
+		dir = TextDirectionAuto
+	}
+	return &textShaper{
+		dir:      dir,
+		opentype: strings.EqualFold(opts.Shaping, TextShapingOpenType),
+		vertical: opts.vertical(),
+		faces:    make(map[string]*shapingFace),
+		shaped:   make(map[shapeKey][]shapedRun),
+	}
+}
+
+// paragraphRTL reports whether the paragraph text runs right to left
+func (s *textShaper) paragraphRTL(text string) bool {
+	if s == nil || s.vertical {
+		return false
+	}
+	switch s.dir {
+	case TextDirectionLTR:
+		return false
+	case TextDirectionRTL:
+		return true
+	}
+	for _, r := range text {
+		switch props, _ := bidi.LookupRune(r); props.Class() {
+		case bidi.L:
+			return false
+		case bidi.R, bidi.AL:
+			return true
+		}
+	}
+	return false
+}
+
+// isVertical reports whether lines are laid out as vertical columns
+func (s *textShaper) isVertical() bool {
+	return s != nil && s.vertical
+}
+
+// hasRTL reports whether text has runes that run right to left
+func hasRTL(text string) bool {
+	for _, r := range text {
+		switch props, _ := bidi.LookupRune(r); props.Class() {
+		case bidi.R, bidi.AL, bidi.AN, bidi.RLE, bidi.RLO, bidi.RLI:
+			return true
+		}
+	}
+	return false
+}
+
+// textPiece is the part of a run in one direction
+type textPiece struct {
+	run textRun
+	rtl bool
+}
+
+// visualPieces splits the runs of the line where the direction changes
+// and returns them in the order they are drawn, from left to right
+func (s *textShaper) visualPieces(line textLine) []textPiece {
+	ltr := func() []textPiece {
+		pieces := make([]textPiece, len(line.runs))
+		for i, run := range line.runs {
+			pieces[i] = textPiece{run: run}
+		}
+		return pieces
+	}
+	text := line.text()
+	if s == nil || s.vertical || (!line.rtl && !hasRTL(text)) {
+		return ltr()
+	}
+
+	// the paragraph sets the direction of a wrapped line, a leading
+	// mark keeps it from being taken from the line's first letter
+	mark := "\u200e" // left-to-right mark
+	if line.rtl {
+		mark = "\u200f" // right-to-left mark
+	}
+	var p bidi.Paragraph
+	if _, err := p.SetString(mark + text); err != nil {
+		return ltr()
+	}
+	order, err := p.Order()
+	if err != nil {
+		return ltr()
+	}
+
+	// the bidi runs as rune ranges of text, in logical order
+	type level struct {
+		start, end int
+		rtl        bool
+	}
+	var levels []level
+	for i := 0; i < order.NumRuns(); i++ {
+		run := order.Run(i)
+		start, end := run.Pos()
+		start = max(start-1, 0)
+		if end < 1 {
+			continue
+		}
+		levels = append(levels, level{start: start, end: end, rtl: run.Direction() == bidi.RightToLeft})
+	}
+
+	// runs against the paragraph direction are drawn in reverse order,
+	// as are all runs of a right to left paragraph
+	visual := make([]level, 0, len(levels))
+	for i := 0; i < len(levels); {
+		j := i + 1
+		if levels[i].rtl != line.rtl {
+			for j < len(levels) && levels[j].rtl != line.rtl {
+				j++
+			}
+			for k := j - 1; k >= i; k-- {
+				visual = append(visual, levels[k])
+			}
+		} else {
+			visual = append(visual, levels[i])
+		}
+		i = j
+	}
+	if line.rtl {
+		for i, j := 0, len(visual)-1; i < j; i, j = i+1, j-1 {
+			visual[i], visual[j] = visual[j], visual[i]
+		}
+	}
+
+	// split the bidi runs at the style runs
+	var pieces []textPiece
+	for _, lv := range visual {
+		var parts []textPiece
+		pos := 0
+		for _, run := range line.runs {
+			runes := []rune(run.text)
+			start, end := max(lv.start, pos), min(lv.end, pos+len(runes))
+			if start < end {
+				part := run
+				part.text = string(runes[start-pos : end-pos])
+				parts = append(parts, textPiece{run: part, rtl: lv.rtl})
+			}
+			pos += len(runes)
+		}
+		if lv.rtl {
+			for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+				parts[i], parts[j] = parts[j], parts[i]
+			}
+		}
+		pieces = append(pieces, parts...)
+	}
+	return pieces
+}
+
+// reverseText reverses s for drawing right to left rune by rune. Marks stay
+// after the rune they belong to and brackets are mirrored.
+func reverseText(s string) string {
+	var clusters []string
+	for _, r := range s {
+		if n := len(clusters); n > 0 && unicode.Is(unicode.Mn, r) {
+			clusters[n-1] += string(r)
+			continue
+		}
+		clusters = append(clusters, bidi.ReverseString(string(r)))
+	}
+	var b strings.Builder
+	for i := len(clusters) - 1; i >= 0; i-- {
+		b.WriteString(clusters[i])
+	}
+	return b.String()
+}
+
+// shape shapes the run at the style size times scale into glyphs in
+// visual order. It returns nil when the text is drawn rune by rune,
+// without TextShapingOpenType or when none of the style's fonts can be shaped.
+func (s *textShaper) shape(run textRun, scale float64, rtl bool) []shapedRun {
+	if s == nil || !s.opentype || s.vertical || run.text == "" {
+		return nil
+	}
+	size := run.style.size * scale
+	key := shapeKey{style: run.style, size: size, text: run.text, rtl: rtl}
+	if runs, ok := s.shaped[key]; ok {
+		return runs
+	}
+
+	var faces fontmap
+	outlines := make(map[*gtfont.Face]*sfnt.Font)
+	for _, name := range run.style.chain.keys {
+		if sf := s.face(run.style.chain, name); sf != nil {
+			faces = append(faces, sf.face)
+			outlines[sf.face] = sf.outlines
+		}
+	}
+	if len(faces) == 0 {
+		s.shaped[key] = nil
+		return nil
+	}
+
+	// harfbuzz shapes at whole pixel sizes
+	px := math.Max(1, math.Ceil(size))
+	dir := di.DirectionLTR
+	if rtl {
+		dir = di.DirectionRTL
+	}
+	text := []rune(run.text)
+	input := shaping.Input{Text: text, RunEnd: len(text), Direction: dir, Size: fixed.I(int(px))}
+	var runs []shapedRun
+	for _, in := range s.seg.Split(input, faces) {
+		out := s.hb.Shape(in)
+		runs = append(runs, shapedRun{out: out, outlines: outlines[in.Face], text: text, scale: size / px})
+	}
+	if rtl {
+		for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+			runs[i], runs[j] = runs[j], runs[i]
+		}
+	}
+	s.shaped[key] = runs
+	return runs
+}
+
+// face returns the shaping face of the registry font name, nil when it cannot be parsed
+func (s *textShaper) face(chain fontChain, name string) *shapingFace {
+	if sf, ok := s.faces[name]; ok {
+		return sf
+	}
+	var sf *shapingFace
+	if f, outlines, err := chain.registry.shapingFont(name); err == nil {
+		sf = &shapingFace{face: gtfont.NewFace(f), outlines: outlines}
+	}
+	s.faces[name] = sf
+	return sf
+}
+
+// fontmap picks the first face with a glyph for a rune, or the first face when none has
+type fontmap []*gtfont.Face
+
+func (fm fontmap) ResolveFace(r rune) *gtfont.Face {
+	for _, face := range fm {
+		if _, ok := face.NominalGlyph(r); ok {
+			return face
+		}
+	}
+	return fm[0]
+}
+
+// shapedWidth is the advance of the shaped runs and the number of letters,
+// glyph clusters, they have
+func shapedWidth(runs []shapedRun) (float64, int) {
+	var w float64
+	n := 0
+	for _, sr := range runs {
+		w += fixedToFloat(sr.out.Advance) * sr.scale
+		for i, g := range sr.out.Glyphs {
+			if i == 0 || g.ClusterIndex != sr.out.Glyphs[i-1].ClusterIndex {
+				n++
+			}
+		}
+	}
+	return w, n
+}
+
+// drawGlyphs draws the shaped runs at x with their baseline at y and
+// returns the x after them, adding the letter spacing between glyph
+// clusters and wordSpacing after each space
+func (l textLayout) drawGlyphs(dc *gg.Context, runs []shapedRun, x, y, wordSpacing float64) float64 {
+	first := true
+	for _, sr := range runs {
+		ppem := fixed.Int26_6(math.Round(fixedToFloat(sr.out.Size) * sr.scale * 64))
+		for i, g := range sr.out.Glyphs {
+			newCluster := i == 0 || g.ClusterIndex != sr.out.Glyphs[i-1].ClusterIndex
+			if newCluster && !first {
+				x += l.spacing.letter
+			}
+			first = false
+
+			gx := x + fixedToFloat(g.XOffset)*sr.scale
+			gy := y - fixedToFloat(g.YOffset)*sr.scale
+			l.shaper.drawGlyph(dc, sr.outlines, g.GlyphID, ppem, gx, gy)
+			x += fixedToFloat(g.XAdvance) * sr.scale
+			if newCluster && g.ClusterIndex < len(sr.text) && sr.text[g.ClusterIndex] == ' ' {
+				x += wordSpacing
+			}
+		}
+	}
+	return x
+}
+
+// drawGlyph fills the outline of glyph gid at ppem pixels per em with its origin at x, y
+func (s *textShaper) drawGlyph(dc *gg.Context, f *sfnt.Font, gid gtfont.GID, ppem fixed.Int26_6, x, y float64) {
+	segs, err := f.LoadGlyph(&s.buf, sfnt.GlyphIndex(gid), ppem, nil)
+	if err != nil || len(segs) == 0 {
+		return
+	}
+	pt := func(p fixed.Point26_6) (float64, float64) {
+		return x + fixedToFloat(p.X), y + fixedToFloat(p.Y)
+	}
+	for _, seg := range segs {
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			dc.ClosePath()
+			dc.MoveTo(pt(seg.Args[0]))
+		case sfnt.SegmentOpLineTo:
+			dc.LineTo(pt(seg.Args[0]))
+		case sfnt.SegmentOpQuadTo:
+			x1, y1 := pt(seg.Args[0])
+			x2, y2 := pt(seg.Args[1])
+			dc.QuadraticTo(x1, y1, x2, y2)
+		case sfnt.SegmentOpCubeTo:
+			x1, y1 := pt(seg.Args[0])
+			x2, y2 := pt(seg.Args[1])
+			x3, y3 := pt(seg.Args[2])
+			dc.CubicTo(x1, y1, x2, y2, x3, y3)
+		}
+	}
+	dc.ClosePath()
+	dc.Fill()
+}
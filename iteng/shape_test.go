@@ -0,0 +1,222 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func Test_textShaper_paragraphRTL(t *testing.T) {
+	tests := []struct {
+		dir, text string
+		rtl       bool
+	}{
+		{"", "שלום world", true},
+		{TextDirectionAuto, "12 שלום", true},
+		{TextDirectionAuto, "hello שלום", false},
+		{TextDirectionAuto, "123", false},
+		{TextDirectionLTR, "שלום", false},
+		{TextDirectionRTL, "hello", true},
+	}
+	for _, tt := range tests {
+		if rtl := newTextShaper(TextOpt{Direction: tt.dir}).paragraphRTL(tt.text); rtl != tt.rtl {
+			t.Errorf("paragraphRTL(%q) with direction %q = %v; expected %v", tt.text, tt.dir, rtl, tt.rtl)
+		}
+	}
+	if (*textShaper)(nil).paragraphRTL("שלום") {
+		t.Errorf("a nil shaper lays text out right to left")
+	}
+}
+
+func Test_textShaper_visualPieces(t *testing.T) {
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	base := TextOpt{FontSize: 20}.baseStyle(chain)
+	bold := &textStyle{chain: chain, size: 20, bold: true}
+	s := newTextShaper(TextOpt{})
+
+	pieces := func(line textLine) []string {
+		var out []string
+		for _, p := range s.visualPieces(line) {
+			dir := "L"
+			if p.rtl {
+				dir = "R"
+			}
+			out = append(out, dir+":"+p.run.text)
+		}
+		return out
+	}
+	check := func(name string, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: pieces = %q; expected %q", name, got, want)
+			return
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: pieces = %q; expected %q", name, got, want)
+				return
+			}
+		}
+	}
+
+	ltr := textLine{runs: []textRun{{text: "abc אבג def", style: base}}}
+	check("left to right", pieces(ltr), "L:abc ", "R:אבג", "L: def")
+
+	rtl := textLine{runs: []textRun{{text: "אבג abc דהו", style: base}}, rtl: true}
+	check("right to left", pieces(rtl), "R: דהו", "L:abc", "R:אבג ")
+
+	// a right to left run split over two styles is drawn last style first
+	styled := textLine{runs: []textRun{{text: "אב", style: base}, {text: "גד", style: bold}}, rtl: true}
+	got := s.visualPieces(styled)
+	if len(got) != 2 || got[0].run.style != bold || got[1].run.style != base {
+		t.Errorf("styled pieces = %q; expected the bold run first", pieces(styled))
+	}
+
+	// the line direction comes from its paragraph, not its first letter
+	wrapped := textLine{runs: []textRun{{text: "abc אבג", style: base}}, rtl: true}
+	check("wrapped", pieces(wrapped), "R: אבג", "L:abc")
+
+	plain := textLine{runs: []textRun{{text: "hello", style: base}}}
+	check("plain", pieces(plain), "L:hello")
+}
+
+func Test_reverseText(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"abc", "cba"},
+		{"(אב)", "(בא)"},
+		// the sheva stays after the letter it is written on
+		{"אְב", "באְ"},
+	}
+	for _, tt := range tests {
+		if got := reverseText(tt.in); got != tt.out {
+			t.Errorf("reverseText(%q) = %q; expected %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func Test_DrawTextInto_RightToLeft(t *testing.T) {
+	r := NewFontRegistry()
+	if err := r.RegisterFile("phoenician", "../test/NotoSansPhoenician-Regular.ttf"); err != nil {
+		t.Fatalf("RegisterFile returned error: %v", err)
+	}
+	draw := func(opts TextOpt, anchorX float64, text string) *image.RGBA {
+		dc := gg.NewContext(200, 40)
+		dc.SetRGB(1, 1, 1)
+		dc.Clear()
+		opts.FontName, opts.FontSize, opts.Color, opts.Wrap, opts.Layout = "phoenician", 24, "#000000", true, TextLayoutBlock
+		slot := Slot{X: 0, Y: 0, Width: 200, Height: 40, AnchorX: Float(anchorX), IsText: true, TextOpts: opts}
+		if _, err := slot.drawText(context.Background(), dc, r, text); err != nil {
+			t.Fatalf("drawText returned error: %v", err)
+		}
+		return dc.Image().(*image.RGBA)
+	}
+
+	// Phoenician is written right to left, so the first letter is drawn
+	// rightmost, and its lines are aligned right when align_x is not set
+	got := draw(TextOpt{}, 0, "𐤀𐤁𐤂")
+	_, chain := r.resolveTextFonts(context.Background(), TextOpt{FontName: "phoenician"})
+	base := TextOpt{FontSize: 24}.baseStyle(chain)
+	reversed := layoutSpans([]textSpan{{text: "𐤂𐤁𐤀", style: base}}, base, 1, 0, TextOpt{}.spacing(), nil)
+	want := gg.NewContext(200, 40)
+	want.SetRGB(1, 1, 1)
+	want.Clear()
+	reversed.draw(want, textBox{x: 200 - reversed.width, w: reversed.width, h: reversed.height})
+	if !bytes.Equal(got.Pix, want.Image().(*image.RGBA).Pix) {
+		t.Errorf("right to left text was not drawn in reverse")
+	}
+	if left, right := inkColumns(got, 0, 40); left < 100 || right < 190 {
+		t.Errorf("ink spans columns %d to %d; expected the text at the right", left, right)
+	}
+
+	// an explicit alignment is kept
+	if left, _ := inkColumns(draw(TextOpt{AlignX: "left"}, 0, "𐤀𐤁𐤂"), 0, 40); left > 10 {
+		t.Errorf("left aligned text starts at column %d", left)
+	}
+}
+
+func Test_textShaper_OpenType(t *testing.T) {
+	r := NewFontRegistry()
+	if err := r.RegisterFile("tagalog", "../test/NotoSansTagalog-Regular.ttf"); err != nil {
+		t.Fatalf("RegisterFile returned error: %v", err)
+	}
+	_, chain := r.resolveTextFonts(context.Background(), TextOpt{FontName: "tagalog"})
+	style := TextOpt{FontSize: 40}.baseStyle(chain)
+
+	// ka with the i vowel sign, which sits above it
+	run := textRun{text: "ᜃᜒ", style: style}
+	if basic := newTextShaper(TextOpt{}).shape(run, 1, false); basic != nil {
+		t.Errorf("basic shaping shaped the run")
+	}
+	shaped := newTextShaper(TextOpt{Shaping: TextShapingOpenType}).shape(run, 1, false)
+	if len(shaped) != 1 || len(shaped[0].out.Glyphs) != 2 {
+		t.Fatalf("shaped %d runs; expected one run of two glyphs", len(shaped))
+	}
+	mark := shaped[0].out.Glyphs[1]
+	if mark.XAdvance != 0 || mark.XOffset >= 0 {
+		t.Errorf("vowel sign advance %v offset %v; expected it placed back over ka", mark.XAdvance, mark.XOffset)
+	}
+	if w, n := shapedWidth(shaped); n != 1 || w <= 0 {
+		t.Errorf("shapedWidth = %g, %d; expected one cluster", w, n)
+	}
+
+	// latin text shapes to the same width it measures rune by rune
+	_, chain = DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	latin := textRun{text: "Shaped text", style: TextOpt{FontSize: 20}.baseStyle(chain)}
+	latin.face = latin.style.faceAt(1)
+	w, _ := shapedWidth(newTextShaper(TextOpt{Shaping: TextShapingOpenType}).shape(latin, 1, false))
+	if basic := measureText(latin.face, latin.text); math.Abs(w-basic) > 1 {
+		t.Errorf("shaped width = %g; expected about %g", w, basic)
+	}
+}
+
+func Test_DrawTextInto_OpenTypeShaping(t *testing.T) {
+	draw := func(shaping, text string) *image.RGBA {
+		dc := gg.NewContext(200, 60)
+		dc.SetRGB(1, 1, 1)
+		dc.Clear()
+		slot := Slot{X: 10, Y: 10, Width: 180, Height: 40, IsText: true, TextOpts: TextOpt{
+			FontSource: "file", FontPath: "../test/NotoSansTagalog-Regular.ttf", FontSize: 32, Color: "#000000", Shaping: shaping}}
+		if _, err := slot.DrawTextIntoContext(context.Background(), dc, text); err != nil {
+			t.Fatalf("DrawTextIntoContext returned error: %v", err)
+		}
+		return dc.Image().(*image.RGBA)
+	}
+
+	// without marks both draw the same glyphs in the same places
+	if basic, shaped := draw(TextShapingBasic, "ᜃᜋ"), draw(TextShapingOpenType, "ᜃᜋ"); countDark(basic) == 0 || math.Abs(float64(countDark(basic)-countDark(shaped))) > float64(countDark(basic))/10 {
+		t.Errorf("shaped text drew %d pixels; expected about %d", countDark(shaped), countDark(basic))
+	}
+	// the shaped vowel sign moves onto its letter
+	if basic, shaped := draw(TextShapingBasic, "ᜃᜒ"), draw(TextShapingOpenType, "ᜃᜒ"); bytes.Equal(basic.Pix, shaped.Pix) {
+		t.Errorf("shaping did not position the vowel sign")
+	}
+}
+
+// countDark counts the pixels of img that are mostly black
+func countDark(img *image.RGBA) int {
+	n := 0
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i] < 100 && img.Pix[i+1] < 100 && img.Pix[i+2] < 100 && img.Pix[i+3] > 0 {
+			n++
+		}
+	}
+	return n
+}
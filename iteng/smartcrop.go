@@ -0,0 +1,157 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"image"
+	"math"
+
+	imagedraw "golang.org/x/image/draw"
+)
+
+const (
+	// smartSampleSize is the longest side of the copy of an image SmartCrop scores
+	smartSampleSize = 128
+	// smartSkinWeight is the score of a skin toned pixel, edges score up to 1
+	smartSkinWeight = 0.5
+	// smartCenterBias is how much less a crop at the very edge of an image
+	// scores than the same content centered, to prefer centered crops
+	smartCenterBias = 0.1
+)
+
+// SmartCrop returns the crop of src with the aspect ratio w:h that cover
+// mode would take, placed where the image has the most detail. Detail is the
+// density of edges plus skin toned pixels, so subjects and faces are kept.
+// The result depends only on the pixels of src.
+func SmartCrop(src image.Image, w, h int) image.Rectangle {
+	b := src.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	if w <= 0 || h <= 0 || srcW == 0 || srcH == 0 {
+		return b
+	}
+
+	// the crop spans the whole image one way and slides the other
+	scale := maxf(float64(w)/float64(srcW), float64(h)/float64(srcH))
+	cw := min(srcW, int(math.Round(float64(w)/scale)))
+	ch := min(srcH, int(math.Round(float64(h)/scale)))
+	if cw == srcW && ch == srcH {
+		return b
+	}
+
+	// score a small copy, summed across the axis the crop spans
+	sample := minf(1, smartSampleSize/float64(max(srcW, srcH)))
+	sw, sh := max(1, int(float64(srcW)*sample)), max(1, int(float64(srcH)*sample))
+	small := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	imagedraw.ApproxBiLinear.Scale(small, small.Bounds(), src, b, imagedraw.Src, nil)
+	scores := detailScores(small)
+
+	horizontal := cw < srcW
+	n, length := sh, float64(ch)/float64(srcH)*float64(sh)
+	if horizontal {
+		n, length = sw, float64(cw)/float64(srcW)*float64(sw)
+	}
+	lines := make([]float64, n)
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			if horizontal {
+				lines[x] += scores[y*sw+x]
+			} else {
+				lines[y] += scores[y*sw+x]
+			}
+		}
+	}
+
+	run := max(1, int(math.Round(length)))
+	start := bestWindow(lines, run)
+	// back to source pixels, as the same fraction of the room the crop has to slide
+	at := func(room int) int {
+		if n <= run {
+			return 0
+		}
+		return int(math.Round(float64(start) / float64(n-run) * float64(room)))
+	}
+	if horizontal {
+		x := at(srcW - cw)
+		return image.Rect(b.Min.X+x, b.Min.Y, b.Min.X+x+cw, b.Max.Y)
+	}
+	y := at(srcH - ch)
+	return image.Rect(b.Min.X, b.Min.Y+y, b.Max.X, b.Min.Y+y+ch)
+}
+
+// bestWindow is the start of the run of n lines with the highest score,
+// favoring runs near the middle. Ties go to the run nearest the middle,
+// then to the earlier run.
+func bestWindow(lines []float64, n int) int {
+	if n >= len(lines) {
+		return 0
+	}
+	var sum float64
+	for _, v := range lines[:n] {
+		sum += v
+	}
+	last := len(lines) - n
+	best, bestScore, bestOff := 0, math.Inf(-1), math.Inf(1)
+	for start := 0; ; start++ {
+		// 0 for the middle run to 1 for the first and last
+		off := math.Abs(float64(start)-float64(last)/2) / (float64(last) / 2)
+		if score := sum * (1 - smartCenterBias*off); score > bestScore || (score == bestScore && off < bestOff) {
+			best, bestScore, bestOff = start, score, off
+		}
+		if start == last {
+			return best
+		}
+		sum += lines[start+n] - lines[start]
+	}
+}
+
+// detailScores scores every pixel of img by its edge strength and skin tone
+func detailScores(img *image.RGBA) []float64 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	luma := make([]float64, w*h)
+	scores := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+			r, g, bl := img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+			luma[y*w+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)) / 255
+			if isSkinTone(r, g, bl) {
+				scores[y*w+x] = smartSkinWeight
+			}
+		}
+	}
+	at := func(x, y int) float64 {
+		x, y = max(0, min(w-1, x)), max(0, min(h-1, y))
+		return luma[y*w+x]
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gx := at(x+1, y) - at(x-1, y)
+			gy := at(x, y+1) - at(x, y-1)
+			scores[y*w+x] += math.Min(1, math.Hypot(gx, gy))
+		}
+	}
+	return scores
+}
+
+// isSkinTone reports whether a color is in the range of human skin tones in daylight
+func isSkinTone(r, g, b uint8) bool {
+	// r is the largest channel, so the spread is from r to the smaller of g and b
+	lo := g
+	if b < lo {
+		lo = b
+	}
+	return r > 95 && g > 40 && b > 20 && r > g && r > b && r-lo > 15 && r-g > 15
+}
@@ -0,0 +1,110 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// detailedImage is a flat gray w x h image with a checkerboard in r
+func detailedImage(w, h int, r image.Rectangle) *image.RGBA {
+	img := solidImage(w, h, color.RGBA{128, 128, 128, 255})
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if (x/4+y/4)%2 == 0 {
+				img.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+func Test_SmartCrop(t *testing.T) {
+	// the detail is at the right of a wide image
+	wide := detailedImage(300, 100, image.Rect(220, 20, 290, 80))
+	if r := SmartCrop(wide, 1, 1); r.Dx() != 100 || r.Dy() != 100 || !image.Rect(220, 20, 290, 80).In(r) {
+		t.Errorf("SmartCrop of a wide image = %v; expected a 100x100 crop around the detail", r)
+	}
+
+	// and at the top of a tall one
+	tall := detailedImage(100, 400, image.Rect(10, 10, 90, 60))
+	if r := SmartCrop(tall, 2, 1); r.Dx() != 100 || r.Dy() != 50 || r.Min.Y > 10 {
+		t.Errorf("SmartCrop of a tall image = %v; expected a 100x50 crop at the top", r)
+	}
+
+	// skin tones are kept over a flat background
+	skin := solidImage(300, 100, color.RGBA{60, 90, 160, 255})
+	for y := 30; y < 70; y++ {
+		for x := 20; x < 60; x++ {
+			skin.SetRGBA(x, y, color.RGBA{224, 172, 140, 255})
+		}
+	}
+	if r := SmartCrop(skin, 1, 1); !image.Rect(20, 30, 60, 70).In(r) {
+		t.Errorf("SmartCrop = %v; expected the skin toned patch kept", r)
+	}
+
+	// a featureless image is cropped around the center
+	if r := SmartCrop(solidImage(300, 100, color.RGBA{10, 20, 30, 255}), 1, 1); r.Dx() != 100 || r.Min.X < 97 || r.Min.X > 103 {
+		t.Errorf("SmartCrop of a flat image = %v; expected the center", r)
+	}
+	// an image with the aspect ratio already is kept whole
+	if r := SmartCrop(wide, 6, 2); r != wide.Bounds() {
+		t.Errorf("SmartCrop with the image aspect ratio = %v; expected the whole image", r)
+	}
+}
+
+func Test_ResizeImage_Smart(t *testing.T) {
+	src := detailedImage(300, 100, image.Rect(220, 20, 290, 80))
+	a := ResizeImage(src, 50, 50, ResizeModeSmart).(*image.RGBA)
+	b := ResizeImage(src, 50, 50, ResizeModeSmart).(*image.RGBA)
+	if a.Bounds() != image.Rect(0, 0, 50, 50) {
+		t.Fatalf("smart resize returned %v; expected 50x50", a.Bounds())
+	}
+	if !bytes.Equal(a.Pix, b.Pix) {
+		t.Errorf("smart resize is not deterministic")
+	}
+	// cover keeps the flat center, smart keeps the checkerboard
+	if c := ResizeImage(src, 50, 50, ResizeModeCover).(*image.RGBA); countDark(c) != 0 {
+		t.Errorf("cover crop has %d dark pixels; expected the flat center", countDark(c))
+	}
+	if countDark(a) == 0 {
+		t.Errorf("smart crop has no dark pixels; expected the checkerboard")
+	}
+}
+
+func Test_drawImageInto_SmartFocus(t *testing.T) {
+	src := detailedImage(300, 100, image.Rect(220, 20, 290, 80))
+	draw := func(slot Slot) *image.RGBA {
+		canvas := solidImage(50, 50, color.RGBA{255, 255, 255, 255})
+		slot.Width, slot.Height, slot.Mode = 50, 50, ResizeModeSmart
+		if _, err := slot.drawImageInto(context.Background(), canvas, src, nil); err != nil {
+			t.Fatalf("drawImageInto returned error: %v", err)
+		}
+		return canvas
+	}
+	if countDark(draw(Slot{})) == 0 {
+		t.Errorf("smart slot did not keep the checkerboard")
+	}
+	// a focal point is used instead of the content
+	if n := countDark(draw(Slot{FocusX: Float(0)})); n != 0 {
+		t.Errorf("smart slot with a focal point at the left has %d dark pixels; expected the flat left side", n)
+	}
+}
@@ -16,7 +16,10 @@ package iteng
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 )
 
 // Inputs map slotID -> image path or text
@@ -30,27 +33,137 @@ type ResizeMode string
 // fill - stretch the image to fit the slot
 // fit - shrink the image to fit the slot
 // cover - shrink the image to cover the slot
+// smart - cover the slot, cropping where the image has the least detail
 const (
 	ResizeModeFill  ResizeMode = "fill"
 	ResizeModeFit   ResizeMode = "fit"
 	ResizeModeCover ResizeMode = "cover"
+	ResizeModeSmart ResizeMode = "smart"
 )
 
 // Slot defines either an image or text placement in the base image
 type Slot struct {
-	ID       string     `json:"id"`
-	X        int        `json:"x"`
-	Y        int        `json:"y"`
-	Width    int        `json:"width"`
-	Height   int        `json:"height"`
-	Mask     string     `json:"mask,omitempty"`     // circle, rounded, or empty
-	Radius   float64    `json:"radius,omitempty"`   // for rounded
-	AnchorX  float64    `json:"anchor_x,omitempty"` // 0..1
-	AnchorY  float64    `json:"anchor_y,omitempty"` // 0..1
-	Mode     ResizeMode `json:"mode,omitempty"`     // ResizeMode: fill/fit/cover
-	Opacity  float64    `json:"opacity,omitempty"`  // 0.0 - 1.0
-	IsText   bool       `json:"is_text,omitempty"`
-	TextOpts TextOpt    `json:"text_opts,omitempty"`
+	ID        string     `json:"id"`
+	X         int        `json:"x"`
+	Y         int        `json:"y"`
+	Width     int        `json:"width"`
+	Height    int        `json:"height"`
+	Mask      string     `json:"mask,omitempty"`       // circle, rounded, image, linear, radial, or empty
+	Radius    float64    `json:"radius,omitempty"`     // for rounded
+	AnchorX   *float64   `json:"anchor_x,omitempty"`   // 0..1, default 0
+	AnchorY   *float64   `json:"anchor_y,omitempty"`   // 0..1, default 0
+	Mode      ResizeMode `json:"mode,omitempty"`       // ResizeMode: fill/fit/cover
+	Crop      *Crop      `json:"crop,omitempty"`       // part of the source image to use
+	FocusX    *float64   `json:"focus_x,omitempty"`    // 0..1 of the source width cover keeps in view, default 0.5
+	FocusY    *float64   `json:"focus_y,omitempty"`    // 0..1 of the source height cover keeps in view, default 0.5
+	Opacity   *float64   `json:"opacity,omitempty"`    // 0.0 - 1.0, default 1.0
+	Rotation  float64    `json:"rotation,omitempty"`   // degrees clockwise around the anchor
+	FlipH     bool       `json:"flip_h,omitempty"`     // mirror an image slot left to right
+	FlipV     bool       `json:"flip_v,omitempty"`     // mirror an image slot top to bottom
+	SkewX     float64    `json:"skew_x,omitempty"`     // degrees an image slot is slanted along x
+	SkewY     float64    `json:"skew_y,omitempty"`     // degrees an image slot is slanted along y
+	Filters   []Filter   `json:"filters,omitempty"`    // run in order over a resized image before masking
+	BlendMode BlendMode  `json:"blend_mode,omitempty"` // how an image slot mixes with the canvas, default normal
+	IsText    bool       `json:"is_text,omitempty"`
+	TextOpts  TextOpt    `json:"text_opts,omitempty"`
+
+	// image, linear and radial masks
+	MaskImage    string        `json:"mask_image,omitempty"`    // path of a grayscale or alpha image, for image
+	MaskGradient *MaskGradient `json:"mask_gradient,omitempty"` // how the mask fades, for linear and radial
+	MaskInvert   bool          `json:"mask_invert,omitempty"`   // hide what the mask shows and show what it hides
+	MaskFeather  float64       `json:"mask_feather,omitempty"`  // px the mask edges are softened over
+}
+
+// Filter is an image filter, see the Filter types
+type Filter struct {
+	Type   string   `json:"type"`             // blur, grayscale, sepia, ...
+	Amount *float64 `json:"amount,omitempty"` // strength, default 1
+	Radius float64  `json:"radius,omitempty"` // px, for blur and sharpen
+	Angle  float64  `json:"angle,omitempty"`  // degrees, for hue_rotate
+	Color  string   `json:"color,omitempty"`  // hex like #RRGGBB, for tint
+}
+
+// MaskGradient is how a linear or radial mask fades from opaque to
+// transparent, at positions from 0 to 1 along the gradient
+type MaskGradient struct {
+	Angle   float64  `json:"angle,omitempty"`    // degrees clockwise from left to right, for linear
+	Start   float64  `json:"start,omitempty"`    // opaque before, default 0
+	End     *float64 `json:"end,omitempty"`      // transparent after, default 1
+	CenterX *float64 `json:"center_x,omitempty"` // 0..1, for radial, default 0.5
+	CenterY *float64 `json:"center_y,omitempty"` // 0..1, for radial, default 0.5
+}
+
+// EffectiveEnd returns the end of the gradient, 1 when omitted
+func (g MaskGradient) EffectiveEnd() float64 {
+	if g.End == nil {
+		return 1
+	}
+	return *g.End
+}
+
+// Crop is a rectangle of a source image in pixels from its top left
+type Crop struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// FocusInputSuffix names the input that overrides the focal point of an
+// image slot: the input "<slot id>.focus" with the value "fx,fy", e.g. "0.3,0.25"
+const FocusInputSuffix = ".focus"
+
+// Float returns a pointer to v, for setting the optional Slot fields in Go
+func Float(v float64) *float64 {
+	return &v
+}
+
+// String returns a pointer to v, for setting the optional TextOpt fields in Go
+func String(v string) *string {
+	return &v
+}
+
+// EffectiveOpacity returns the slot opacity, 1.0 (fully opaque) when omitted
+func (slot Slot) EffectiveOpacity() float64 {
+	if slot.Opacity == nil {
+		return 1
+	}
+	return *slot.Opacity
+}
+
+// EffectiveAnchor returns the slot anchor, 0 (top left) when omitted.
+// Values outside 0..1 are treated as 0.
+func (slot Slot) EffectiveAnchor() (ax, ay float64) {
+	return unitOr(slot.AnchorX, 0), unitOr(slot.AnchorY, 0)
+}
+
+// EffectiveFocus returns the slot focal point, 0.5 (the center) when omitted.
+// Values outside 0..1 are treated as 0.5.
+func (slot Slot) EffectiveFocus() (fx, fy float64) {
+	return unitOr(slot.FocusX, 0.5), unitOr(slot.FocusY, 0.5)
+}
+
+// parseFocus parses a focal point input "fx,fy"
+func parseFocus(s string) (fx, fy float64, err error) {
+	x, y, ok := strings.Cut(s, ",")
+	if ok {
+		fx, err = strconv.ParseFloat(strings.TrimSpace(x), 64)
+	}
+	if ok && err == nil {
+		fy, err = strconv.ParseFloat(strings.TrimSpace(y), 64)
+	}
+	if !ok || err != nil || fx < 0 || fx > 1 || fy < 0 || fy > 1 {
+		return 0, 0, fmt.Errorf("invalid focus %q, expected fx,fy between 0 and 1", s)
+	}
+	return fx, fy, nil
+}
+
+// unitOr returns v, or def when v is omitted or outside 0..1
+func unitOr(v *float64, def float64) float64 {
+	if v == nil || *v < 0 || *v > 1 {
+		return def
+	}
+	return *v
 }
 
 // TextOpt defines text options for a Slot
@@ -61,10 +174,96 @@ type TextOpt struct {
 	FontURL    string  `json:"font_url,omitempty"`    // URL to download font from
 	FontSize   float64 `json:"font_size,omitempty"`
 	Color      string  `json:"color,omitempty"`   // hex like #RRGGBB
-	AlignX     string  `json:"align_x,omitempty"` // left, center, right
+	AlignX     string  `json:"align_x,omitempty"` // left, center, right, justify
 	AlignY     string  `json:"align_y,omitempty"` // top, middle, bottom
 	Wrap       bool    `json:"wrap,omitempty"`
 	MaxWidth   int     `json:"max_width,omitempty"` // px for wrapping
+	// Layout "block" places the lines as a block against the anchor and wraps
+	// at the slot size without MaxWidth, see the Text layouts
+	Layout string `json:"layout,omitempty"` // "baseline" or "block", default "baseline"
+	// Fonts are tried in order for runes the font above has no glyph for
+	Fonts []FontRef `json:"fonts,omitempty"`
+	// Fit "shrink" draws at the largest size from MaxFontSize down to
+	// MinFontSize whose layout fits inside the slot Width and Height
+	Fit         string  `json:"fit,omitempty"`           // "none" or "shrink", default "none"
+	MinFontSize float64 `json:"min_font_size,omitempty"` // default 6
+	MaxFontSize float64 `json:"max_font_size,omitempty"` // default FontSize
+	// MaxLines drops the lines after it, 0 for no limit
+	MaxLines int `json:"max_lines,omitempty"`
+	// Overflow "truncate" also drops the lines below the slot Height and
+	// shortens lines wider than the slot
+	Overflow string `json:"overflow,omitempty"` // "visible" or "truncate", default "visible"
+	// Ellipsis ends truncated text, "…" when omitted
+	Ellipsis *string `json:"ellipsis,omitempty"`
+	// LineHeight is the distance between baselines as a multiple of the font height
+	LineHeight       float64 `json:"line_height,omitempty"`       // default 1.4
+	LetterSpacing    float64 `json:"letter_spacing,omitempty"`    // px added between letters, may be negative
+	ParagraphSpacing float64 `json:"paragraph_spacing,omitempty"` // px added between paragraphs
+	// Stroke outlines the glyphs, drawn beneath the glyph fill
+	Stroke *TextStroke `json:"stroke,omitempty"`
+	// Shadows are drawn in order beneath the stroke and glyph fill
+	Shadows []TextShadow `json:"shadows,omitempty"`
+	// Background fills a box sized to the text beneath the text and its effects
+	Background *TextBackground `json:"background,omitempty"`
+	// Markup styles parts of the text input with tags like <b> and <span color="#f00">
+	Markup bool `json:"markup,omitempty"`
+	// BoldFont and ItalicFont draw <b> and <i> markup, which is
+	// synthesized from the font above when they are omitted
+	BoldFont   *FontRef `json:"bold_font,omitempty"`
+	ItalicFont *FontRef `json:"italic_font,omitempty"`
+	// Direction is the direction of each paragraph, right to left paragraphs
+	// are aligned right unless AlignX is set
+	Direction string `json:"direction,omitempty"` // "auto", "ltr" or "rtl", default "auto"
+	// Shaping "opentype" shapes the text with the font's OpenType tables for
+	// ligatures, joined Arabic letters and marks placed on their base letters
+	Shaping string `json:"shaping,omitempty"` // "basic" or "opentype", default "basic"
+	// WritingMode "vertical" sets upright glyphs in columns that run top to
+	// bottom and stack right to left, with MaxWidth as the column length
+	WritingMode string `json:"writing_mode,omitempty"` // "horizontal" or "vertical", default "horizontal"
+}
+
+// TextStroke is an outline around the glyphs of a text slot
+type TextStroke struct {
+	Color string  `json:"color,omitempty"` // hex like #RRGGBB, default black
+	Width float64 `json:"width"`           // px outside the glyph edge
+}
+
+// TextBackground is a box drawn behind the text of a text slot
+type TextBackground struct {
+	Color   string  `json:"color,omitempty"`   // hex like #RRGGBBAA, default black
+	Padding float64 `json:"padding,omitempty"` // px between the text and the box edge
+	Radius  float64 `json:"radius,omitempty"`  // px corner radius
+	Mode    string  `json:"mode,omitempty"`    // "block" or "lines", default "block"
+}
+
+// TextShadow is a drop shadow of the text of a text slot
+type TextShadow struct {
+	OffsetX float64  `json:"offset_x,omitempty"` // px, positive moves right
+	OffsetY float64  `json:"offset_y,omitempty"` // px, positive moves down
+	Blur    float64  `json:"blur,omitempty"`     // blur radius in px
+	Color   string   `json:"color,omitempty"`    // hex like #RRGGBB, default black
+	Opacity *float64 `json:"opacity,omitempty"`  // 0.0 - 1.0, default 1.0
+}
+
+// EffectiveOpacity returns the shadow opacity, 1.0 (fully opaque) when omitted
+func (sh TextShadow) EffectiveOpacity() float64 {
+	if sh.Opacity == nil {
+		return 1
+	}
+	return *sh.Opacity
+}
+
+// FontRef names a font the same way the font fields of TextOpt do
+type FontRef struct {
+	Source string `json:"source,omitempty"` // "file", "system", "url", "embedded", or "" for auto
+	Path   string `json:"path,omitempty"`   // filesystem path
+	Name   string `json:"name,omitempty"`   // registered or system font name
+	URL    string `json:"url,omitempty"`    // URL to download font from
+}
+
+// primaryFont returns the font configured by the TextOpt font fields
+func (opts TextOpt) primaryFont() FontRef {
+	return FontRef{Source: opts.FontSource, Path: opts.FontPath, Name: opts.FontName, URL: opts.FontURL}
 }
 
 // Template defines the base image, Output options, and Slots
@@ -72,7 +271,9 @@ type Template struct {
 	// TemplateImage is the path to the base image to use for the template
 	TemplateImage string `json:"template_image"`
 	Output        Output `json:"output"`
-	Slots         []Slot `json:"slots"`
+	// Filters run in order over the base image after it is scaled to the output
+	Filters []Filter `json:"filters,omitempty"`
+	Slots   []Slot   `json:"slots"`
 }
 
 // Output defines the output image size and format
@@ -15,6 +15,7 @@
 package iteng
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -73,3 +74,32 @@ func TestParseTemplate(t *testing.T) {
 		t.Errorf("Expected height to be %d, but got %d", expected, height)
 	}
 }
+
+func TestSlotDefaults(t *testing.T) {
+	var tmpl Template
+	data := `{"slots": [
+		{"id": "omitted"},
+		{"id": "explicit", "opacity": 0, "anchor_x": 0.5, "anchor_y": 1},
+		{"id": "invalid", "anchor_x": 2, "anchor_y": -1}
+	]}`
+	if err := json.Unmarshal([]byte(data), &tmpl); err != nil {
+		t.Fatalf("Unmarshal failed with error: %v", err)
+	}
+
+	omitted, explicit, invalid := tmpl.Slots[0], tmpl.Slots[1], tmpl.Slots[2]
+	if o := omitted.EffectiveOpacity(); o != 1 {
+		t.Errorf("omitted opacity = %g; expected 1", o)
+	}
+	if ax, ay := omitted.EffectiveAnchor(); ax != 0 || ay != 0 {
+		t.Errorf("omitted anchor = %g,%g; expected 0,0", ax, ay)
+	}
+	if o := explicit.EffectiveOpacity(); o != 0 {
+		t.Errorf("explicit opacity = %g; expected 0", o)
+	}
+	if ax, ay := explicit.EffectiveAnchor(); ax != 0.5 || ay != 1 {
+		t.Errorf("explicit anchor = %g,%g; expected 0.5,1", ax, ay)
+	}
+	if ax, ay := invalid.EffectiveAnchor(); ax != 0 || ay != 0 {
+		t.Errorf("invalid anchor = %g,%g; expected 0,0", ax, ay)
+	}
+}
@@ -0,0 +1,949 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// defaultLineSpacing is the distance between baselines as a multiple of the font height
+	defaultLineSpacing = 1.4
+	// defaultMinFontSize is the smallest size TextOpt.Fit shrinks text to
+	defaultMinFontSize = 6
+	// fitStep is the font size precision of TextOpt.Fit
+	fitStep = 0.5
+	// maxStrokeWidth and maxShadowBlur bound the text effects, larger values are drawn at the bound
+	maxStrokeWidth = 20
+	maxShadowBlur  = 100
+)
+
+// defaultEllipsis ends truncated text when TextOpt.Ellipsis is omitted
+const defaultEllipsis = "…"
+
+// Text overflow modes for TextOpt.Overflow
+// visible - draw every line even past the slot
+// truncate - drop lines below the slot height and shorten lines wider than the slot
+const (
+	TextOverflowVisible  = "visible"
+	TextOverflowTruncate = "truncate"
+)
+
+// Writing modes for TextOpt.WritingMode
+// horizontal - lines run left to right and stack down
+// vertical - upright glyphs run down in columns that stack right to left, as in CJK
+const (
+	TextWritingModeHorizontal = "horizontal"
+	TextWritingModeVertical   = "vertical"
+)
+
+// Text layouts for TextOpt.Layout
+// baseline - a single line sits on the anchor, moved down by the font height
+// for align_y middle and bottom, and wrap needs MaxWidth, as text was first drawn
+// block - align_x and align_y place the block of lines against the anchor and
+// wrap without MaxWidth breaks lines at the slot width. Vertical text is a block.
+const (
+	TextLayoutBaseline = "baseline"
+	TextLayoutBlock    = "block"
+)
+
+// Text background modes for TextBackground.Mode
+// block - one box around all the lines
+// lines - a box around each line
+const (
+	TextBackgroundBlock = "block"
+	TextBackgroundLines = "lines"
+)
+
+// Text fit modes for TextOpt.Fit
+// none - draw at FontSize
+// shrink - draw at the largest size that fits the slot
+const (
+	TextFitNone   = "none"
+	TextFitShrink = "shrink"
+)
+
+// textSpacing is the spacing between the parts of a text layout
+type textSpacing struct {
+	// line is the distance between baselines as a multiple of the font height
+	line float64
+	// letter is added between runes, in pixels
+	letter float64
+	// paragraph is added between paragraphs, in pixels
+	paragraph float64
+}
+
+// spacing returns the text spacing with defaults applied
+func (opts TextOpt) spacing() textSpacing {
+	sp := textSpacing{line: opts.LineHeight, letter: opts.LetterSpacing, paragraph: opts.ParagraphSpacing}
+	if sp.line <= 0 {
+		sp.line = defaultLineSpacing
+	}
+	return sp
+}
+
+// textStyle is how a span of text is drawn
+type textStyle struct {
+	chain fontChain
+	// size is the font size before TextOpt.Fit scales the text
+	size  float64
+	color color.Color
+	// bold and italic are synthesized, they are not set when a font for them is used
+	bold, italic      bool
+	underline, strike bool
+}
+
+// faceAt returns the face for the style with its size scaled,
+// gg's builtin face when the style has no fonts
+func (st *textStyle) faceAt(scale float64) font.Face {
+	if face := st.chain.face(st.size * scale); face != nil {
+		return face
+	}
+	return basicfont.Face7x13
+}
+
+// textSpan is text drawn in one style
+type textSpan struct {
+	text  string
+	style *textStyle
+}
+
+// textRun is the part of a line drawn in one style
+type textRun struct {
+	text  string
+	style *textStyle
+	face  font.Face
+}
+
+// textLine is a laid out line of text
+type textLine struct {
+	runs []textRun
+	// width is the advance of the line
+	width float64
+	// baseline is the distance from the top of the text
+	baseline float64
+	// ascent and descent are the largest of the runs
+	ascent, descent float64
+	// height is the largest font height of the runs
+	height float64
+	// last is set for the last line of a paragraph
+	last bool
+	// rtl is set for the lines of a right to left paragraph
+	rtl bool
+}
+
+// text returns the text of the line
+func (line textLine) text() string {
+	var b strings.Builder
+	for _, run := range line.runs {
+		b.WriteString(run.text)
+	}
+	return b.String()
+}
+
+// textLayout is text broken into lines of styled runs
+type textLayout struct {
+	// size is the font size of the TextOpt style after scaling
+	size    float64
+	scale   float64
+	spacing textSpacing
+	shaper  *textShaper
+	// base is the TextOpt style, which sets the height of empty lines
+	base  *textStyle
+	faces map[*textStyle]font.Face
+	lines []textLine
+	// width is the widest line
+	width float64
+	// height is from the top of the first line to the bottom of the last
+	height float64
+	// truncated is set when lines were dropped or shortened
+	truncated bool
+	// alignStart aligns right to left lines right, for text without TextOpt.AlignX
+	alignStart bool
+}
+
+// layoutSpans breaks the spans into lines at newlines and, when wrapWidth
+// is positive, between words so lines are no wider than wrapWidth.
+// A word wider than wrapWidth gets a line of its own. Font sizes are
+// multiplied by scale. The shaper, which may be nil, measures the runs
+// and sets the direction of each paragraph.
+func layoutSpans(spans []textSpan, base *textStyle, scale, wrapWidth float64, spacing textSpacing, shaper *textShaper) textLayout {
+	l := textLayout{
+		size:    base.size * scale,
+		scale:   scale,
+		spacing: spacing,
+		shaper:  shaper,
+		base:    base,
+		faces:   make(map[*textStyle]font.Face),
+	}
+
+	var para []textRun
+	endParagraph := func() {
+		rtl := shaper.paragraphRTL(textLine{runs: para}.text())
+		lines := [][]textRun{para}
+		if wrapWidth > 0 {
+			lines = l.wrapRuns(para, wrapWidth)
+		}
+		for i, runs := range lines {
+			l.lines = append(l.lines, textLine{runs: mergeRuns(runs), last: i == len(lines)-1, rtl: rtl})
+		}
+		para = nil
+	}
+	for _, sp := range spans {
+		for i, text := range strings.Split(sp.text, "\n") {
+			if i > 0 {
+				endParagraph()
+			}
+			if text != "" {
+				para = append(para, l.run(text, sp.style))
+			}
+		}
+	}
+	endParagraph()
+
+	l.measure()
+	return l
+}
+
+// run returns a run of text in the style
+func (l *textLayout) run(text string, style *textStyle) textRun {
+	face, ok := l.faces[style]
+	if !ok {
+		face = style.faceAt(l.scale)
+		l.faces[style] = face
+	}
+	return textRun{text: text, style: style, face: face}
+}
+
+// mergeRuns joins neighboring runs of the same style
+func mergeRuns(runs []textRun) []textRun {
+	var out []textRun
+	for _, run := range runs {
+		if n := len(out); n > 0 && out[n-1].style == run.style {
+			out[n-1].text += run.text
+			continue
+		}
+		out = append(out, run)
+	}
+	return out
+}
+
+// measure sets the widths, metrics, baselines and height for the lines
+func (l *textLayout) measure() {
+	l.width = 0
+	for i := range l.lines {
+		line := &l.lines[i]
+		line.width = l.runsWidth(line.runs)
+		l.width = maxf(l.width, line.width)
+
+		line.ascent, line.descent, line.height = 0, 0, 0
+		faces := []font.Face{l.run("", l.base).face}
+		if len(line.runs) > 0 {
+			faces = faces[:0]
+			for _, run := range line.runs {
+				faces = append(faces, run.face)
+			}
+		}
+		for _, face := range faces {
+			m := face.Metrics()
+			line.ascent = maxf(line.ascent, fixedToFloat(m.Ascent))
+			line.descent = maxf(line.descent, fixedToFloat(m.Descent))
+			line.height = maxf(line.height, fixedToFloat(m.Height))
+		}
+
+		if i == 0 {
+			line.baseline = line.ascent
+			continue
+		}
+		prev := l.lines[i-1]
+		line.baseline = prev.baseline + line.height*l.spacing.line
+		if prev.last {
+			line.baseline += l.spacing.paragraph
+		}
+	}
+	l.height = l.linesHeight(len(l.lines))
+}
+
+// linesHeight is the height of the first n lines
+func (l *textLayout) linesHeight(n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return l.lines[n-1].baseline + l.lines[n-1].descent
+}
+
+// runsWidth is the advance of the runs including letter spacing
+func (l *textLayout) runsWidth(runs []textRun) float64 {
+	var w float64
+	n := 0
+	for _, run := range runs {
+		rw, rn := l.runAdvance(run)
+		w += rw
+		n += rn
+	}
+	if n > 1 {
+		w += l.spacing.letter * float64(n-1)
+	}
+	return w
+}
+
+// runAdvance is the advance of the run without letter spacing and the number of letters it has
+func (l *textLayout) runAdvance(run textRun) (float64, int) {
+	if l.shaper.isVertical() {
+		// upright glyphs advance down a column by one em
+		n := utf8.RuneCountInString(run.text)
+		return float64(n) * run.style.size * l.scale, n
+	}
+	if shaped := l.shaper.shape(run, l.scale, hasRTL(run.text)); shaped != nil {
+		return shapedWidth(shaped)
+	}
+	return measureText(run.face, run.text), utf8.RuneCountInString(run.text)
+}
+
+// texts returns the text of the lines
+func (l *textLayout) texts() []string {
+	texts := make([]string, len(l.lines))
+	for i, line := range l.lines {
+		texts[i] = line.text()
+	}
+	return texts
+}
+
+// truncate drops the lines after maxLines and those that end below height,
+// ending the last line kept with suffix so it is at most width wide.
+// At least one line is kept, zero limits are not applied.
+func (l *textLayout) truncate(maxLines int, height, width float64, suffix string) {
+	n := len(l.lines)
+	if maxLines > 0 && n > maxLines {
+		n = maxLines
+	}
+	for height > 0 && n > 1 && l.linesHeight(n) > height {
+		n--
+	}
+	if n == len(l.lines) {
+		return
+	}
+	l.lines = l.lines[:n]
+	l.lines[n-1].runs = l.ellipsize(l.lines[n-1].runs, width, suffix)
+	l.lines[n-1].last = true
+	l.truncated = true
+	l.measure()
+}
+
+// clip shortens lines wider than width so they end with suffix
+func (l *textLayout) clip(width float64, suffix string) {
+	clipped := false
+	for i, line := range l.lines {
+		if line.width > width {
+			l.lines[i].runs = l.ellipsize(line.runs, width, suffix)
+			l.lines[i].last = true
+			clipped = true
+		}
+	}
+	if clipped {
+		l.truncated = true
+		l.measure()
+	}
+}
+
+// ellipsize drops runes from the end of the runs until they fit width with
+// suffix appended in the style of the last run, a zero width only appends suffix
+func (l *textLayout) ellipsize(runs []textRun, width float64, suffix string) []textRun {
+	style := l.base
+	if len(runs) > 0 {
+		style = runs[len(runs)-1].style
+	}
+	runs = append([]textRun(nil), runs...)
+	withSuffix := func() []textRun {
+		if suffix == "" {
+			return runs
+		}
+		return append(runs[:len(runs):len(runs)], l.run(suffix, style))
+	}
+
+	// trimming can drop every run, then only the suffix is left
+	for trimRunsRight(&runs); width > 0 && len(runs) > 0 && l.runsWidth(withSuffix()) > width; trimRunsRight(&runs) {
+		last := &runs[len(runs)-1]
+		_, size := utf8.DecodeLastRuneInString(last.text)
+		last.text = last.text[:len(last.text)-size]
+	}
+	return mergeRuns(withSuffix())
+}
+
+// trimRunsRight drops trailing spaces and empty runs
+func trimRunsRight(runs *[]textRun) {
+	for len(*runs) > 0 {
+		last := &(*runs)[len(*runs)-1]
+		last.text = strings.TrimRightFunc(last.text, unicode.IsSpace)
+		if last.text != "" {
+			return
+		}
+		*runs = (*runs)[:len(*runs)-1]
+	}
+}
+
+// wrapRuns splits the runs of a paragraph between words so each line is at
+// most width wide. Words may span runs, spaces at line ends are dropped.
+func (l *textLayout) wrapRuns(runs []textRun, width float64) [][]textRun {
+	if l.shaper.isVertical() {
+		return l.wrapColumns(runs, width)
+	}
+	// split the runs into words and the spaces between them
+	type piece struct {
+		runs  []textRun
+		space bool
+	}
+	var pieces []piece
+	for _, run := range runs {
+		for _, word := range splitWords(run.text) {
+			space := strings.TrimSpace(word) == ""
+			r := textRun{text: word, style: run.style, face: run.face}
+			if n := len(pieces); n > 0 && pieces[n-1].space == space {
+				pieces[n-1].runs = append(pieces[n-1].runs, r)
+				continue
+			}
+			pieces = append(pieces, piece{runs: []textRun{r}, space: space})
+		}
+	}
+
+	var lines [][]textRun
+	var cur, spaces []textRun
+	for _, p := range pieces {
+		if p.space {
+			if len(cur) > 0 {
+				spaces = append(spaces, p.runs...)
+			}
+			continue
+		}
+		next := append(append(append([]textRun(nil), cur...), spaces...), p.runs...)
+		if len(cur) > 0 && l.runsWidth(next) > width {
+			lines = append(lines, cur)
+			next = append([]textRun(nil), p.runs...)
+		}
+		cur, spaces = next, nil
+	}
+	if len(cur) > 0 || len(lines) == 0 {
+		lines = append(lines, cur)
+	}
+	return lines
+}
+
+// wrapColumns splits the runs of a paragraph between any two letters, as
+// vertical CJK text is broken, so each column is at most length long.
+// Spaces at the start of a column are dropped.
+func (l *textLayout) wrapColumns(runs []textRun, length float64) [][]textRun {
+	var cols [][]textRun
+	var cur []textRun
+	var w float64
+	for _, run := range runs {
+		em := run.style.size * l.scale
+		for _, r := range run.text {
+			adv := em
+			if len(cur) > 0 {
+				adv += l.spacing.letter
+			}
+			if len(cur) > 0 && w+adv > length {
+				cols = append(cols, cur)
+				cur, w, adv = nil, 0, em
+			}
+			if len(cur) == 0 && len(cols) > 0 && unicode.IsSpace(r) {
+				continue
+			}
+			cur = mergeRuns(append(cur, textRun{text: string(r), style: run.style, face: run.face}))
+			w += adv
+		}
+	}
+	if len(cur) > 0 || len(cols) == 0 {
+		cols = append(cols, cur)
+	}
+	return cols
+}
+
+// splitWords splits s into alternating runs of spaces and non spaces
+func splitWords(s string) []string {
+	var words []string
+	start := 0
+	prevSpace := false
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if i > 0 && space != prevSpace {
+			words = append(words, s[start:i])
+			start = i
+		}
+		prevSpace = space
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+func measureText(face font.Face, s string) float64 {
+	return fixedToFloat(font.MeasureString(face, s))
+}
+
+func fixedToFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
+
+// fits reports whether the layout fits inside w x h, a zero size is unbounded
+func (l textLayout) fits(w, h float64) bool {
+	if l.shaper.isVertical() {
+		// lines are columns
+		w, h = h, w
+	}
+	return (w <= 0 || l.width <= w) && (h <= 0 || l.height <= h)
+}
+
+// textBox is the rectangle a layout is drawn in and how its lines are placed in it
+type textBox struct {
+	x, y, w, h float64
+	// align places each line along the box, 0 for the start to 1 for the end
+	align float64
+	// justify stretches lines, except the last of a paragraph, to the box
+	justify bool
+}
+
+// rotatedBounds is the bounding box of the box rotated by degrees clockwise around cx, cy
+func (box textBox) rotatedBounds(degrees, cx, cy float64) image.Rectangle {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range [][2]float64{{box.x, box.y}, {box.x + box.w, box.y}, {box.x, box.y + box.h}, {box.x + box.w, box.y + box.h}} {
+		dx, dy := p[0]-cx, p[1]-cy
+		x, y := cx+dx*cos-dy*sin, cy+dx*sin+dy*cos
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	return image.Rect(int(math.Floor(minX+1e-9)), int(math.Floor(minY+1e-9)), int(math.Ceil(maxX-1e-9)), int(math.Ceil(maxY-1e-9)))
+}
+
+// draw draws the lines in the box. Lines are placed in the box by its
+// alignment, 0 for left to 1 for right, and the last line of a right to
+// left paragraph is aligned right. Vertical text is drawn by drawColumns.
+func (l textLayout) draw(dc *gg.Context, box textBox) {
+	if l.shaper.isVertical() {
+		l.drawColumns(dc, box)
+		return
+	}
+	for _, line := range l.lines {
+		lx, wordSpacing := l.lineStart(line, box)
+		l.drawLine(dc, line, lx, box.y+line.baseline, wordSpacing)
+	}
+}
+
+// lineStart is the x line starts at in box and the spacing added after each
+// space to justify it
+func (l textLayout) lineStart(line textLine, box textBox) (float64, float64) {
+	lx := box.x + (box.w-line.width)*box.align
+	if l.alignStart && line.rtl {
+		lx = box.x + box.w - line.width
+	}
+	if box.justify && !line.last {
+		if gaps := strings.Count(line.text(), " "); gaps > 0 && line.width < box.w {
+			return box.x, (box.w - line.width) / float64(gaps)
+		}
+	} else if box.justify && line.rtl {
+		lx = box.x + box.w - line.width
+	}
+	return lx, 0
+}
+
+// lineRects are the rectangles the lines of the layout cover when drawn in
+// box, from the ascent to the descent of each line and across its drawn
+// width. Vertical lines cover their column. Empty lines have zero width.
+func (l textLayout) lineRects(box textBox) []textBox {
+	rects := make([]textBox, len(l.lines))
+	for i, line := range l.lines {
+		if l.shaper.isVertical() {
+			right := box.x + box.w - (line.baseline - line.ascent)
+			rects[i] = textBox{x: right - (line.ascent + line.descent), y: box.y + (box.h-line.width)*box.align, w: line.ascent + line.descent, h: line.width}
+			continue
+		}
+		lx, wordSpacing := l.lineStart(line, box)
+		w := line.width
+		if wordSpacing > 0 {
+			w = box.w
+		}
+		rects[i] = textBox{x: lx, y: box.y + line.baseline - line.ascent, w: w, h: line.ascent + line.descent}
+	}
+	return rects
+}
+
+// backgroundRects are the boxes of bg behind the layout drawn in box, one
+// around all the lines or one per line that is not empty, grown by the padding
+func (l textLayout) backgroundRects(box textBox, bg TextBackground) []textBox {
+	var rects []textBox
+	lines := strings.EqualFold(bg.Mode, TextBackgroundLines)
+	for _, r := range l.lineRects(box) {
+		if r.w <= 0 || r.h <= 0 {
+			continue
+		}
+		if lines || len(rects) == 0 {
+			rects = append(rects, r)
+			continue
+		}
+		// grow the block to cover the line
+		b := &rects[0]
+		x0, y0 := math.Min(b.x, r.x), math.Min(b.y, r.y)
+		b.w, b.h = math.Max(b.x+b.w, r.x+r.w)-x0, math.Max(b.y+b.h, r.y+r.h)-y0
+		b.x, b.y = x0, y0
+	}
+	for i := range rects {
+		rects[i].x -= bg.Padding
+		rects[i].y -= bg.Padding
+		rects[i].w += 2 * bg.Padding
+		rects[i].h += 2 * bg.Padding
+	}
+	return rects
+}
+
+// drawBackground fills the boxes of bg behind the layout drawn in box.
+// The boxes are filled as one path, so boxes that overlap do not darken.
+func (l textLayout) drawBackground(dc *gg.Context, box textBox, bg TextBackground) {
+	rects := l.backgroundRects(box, bg)
+	if len(rects) == 0 {
+		return
+	}
+	for _, r := range rects {
+		radius := math.Min(bg.Radius, math.Min(r.w, r.h)/2)
+		if radius > 0 {
+			dc.DrawRoundedRectangle(r.x, r.y, r.w, r.h, radius)
+		} else {
+			dc.DrawRectangle(r.x, r.y, r.w, r.h)
+		}
+	}
+	dc.SetColor(hexColorOr(bg.Color, color.Black))
+	dc.Fill()
+}
+
+// drawColumns draws the lines as columns from the right of the box, each
+// placed down the box by its alignment, 0 for top to 1 for bottom.
+// Glyphs are upright and centered across their column.
+func (l textLayout) drawColumns(dc *gg.Context, box textBox) {
+	for _, line := range l.lines {
+		// a column spans the extent a line has across the text, from the right
+		right := box.x + box.w - (line.baseline - line.ascent)
+		cx := right - (line.ascent+line.descent)/2
+		y := box.y + (box.h-line.width)*box.align
+		first := true
+		for _, run := range line.runs {
+			em := run.style.size * l.scale
+			m := run.face.Metrics()
+			ascent, descent := fixedToFloat(m.Ascent), fixedToFloat(m.Descent)
+			for _, r := range run.text {
+				if !first {
+					y += l.spacing.letter
+				}
+				first = false
+				adv, _ := run.face.GlyphAdvance(r)
+				glyph := textLine{runs: []textRun{{text: string(r), style: run.style, face: run.face}}}
+				// the ascent and descent of the font share the em
+				l.drawLine(dc, glyph, cx-fixedToFloat(adv)/2, y+em*ascent/(ascent+descent), 0)
+				y += em
+			}
+		}
+	}
+}
+
+// drawLine draws the runs of line in visual order with their baseline at y,
+// adding the letter spacing between runes and wordSpacing after each space
+func (l textLayout) drawLine(dc *gg.Context, line textLine, x, y, wordSpacing float64) {
+	for i, piece := range l.shaper.visualPieces(line) {
+		run := piece.run
+		if i > 0 {
+			x += l.spacing.letter
+		}
+		start := x
+		size := run.style.size * l.scale
+		dc.SetFontFace(run.face)
+		dc.SetColor(run.style.color)
+
+		if run.style.italic {
+			// slant the glyphs around the baseline
+			dc.Push()
+			dc.ShearAbout(-0.2, 0, x, y)
+		}
+		x = l.drawRun(dc, run, piece.rtl, x, y, wordSpacing)
+		if run.style.bold {
+			// overdraw the glyphs shifted to thicken their stems
+			l.drawRun(dc, run, piece.rtl, start+math.Max(0.5, size/30), y, wordSpacing)
+		}
+		if run.style.italic {
+			dc.Pop()
+		}
+
+		thickness := math.Max(1, size/16)
+		if run.style.underline {
+			dc.DrawRectangle(start, y+size/10, x-start, thickness)
+			dc.Fill()
+		}
+		if run.style.strike {
+			dc.DrawRectangle(start, y-size*0.3, x-start, thickness)
+			dc.Fill()
+		}
+	}
+}
+
+// drawRun draws the run at x with its baseline at y and returns the x after it.
+// Right to left runs are drawn reversed unless they are shaped.
+func (l textLayout) drawRun(dc *gg.Context, run textRun, rtl bool, x, y, wordSpacing float64) float64 {
+	if shaped := l.shaper.shape(run, l.scale, rtl); shaped != nil {
+		return l.drawGlyphs(dc, shaped, x, y, wordSpacing)
+	}
+	if rtl {
+		run.text = reverseText(run.text)
+	}
+	if l.spacing.letter == 0 && wordSpacing == 0 {
+		dc.DrawString(run.text, x, y)
+		return x + measureText(run.face, run.text)
+	}
+	prev := rune(-1)
+	for _, r := range run.text {
+		if prev >= 0 {
+			x += fixedToFloat(run.face.Kern(prev, r)) + l.spacing.letter
+		}
+		dc.DrawString(string(r), x, y)
+		adv, _ := run.face.GlyphAdvance(r)
+		x += fixedToFloat(adv)
+		if r == ' ' {
+			x += wordSpacing
+		}
+		prev = r
+	}
+	return x
+}
+
+// wrapWidth is the width wrapped text is broken to, MaxWidth or else the
+// slot Width, and 0 when the text is not wrapped. Vertical text is broken
+// into columns of MaxWidth or else the slot Height.
+func (slot Slot) wrapWidth() float64 {
+	opts := slot.TextOpts
+	if !opts.Wrap {
+		return 0
+	}
+	if opts.MaxWidth > 0 {
+		return float64(opts.MaxWidth)
+	}
+	if !opts.block() {
+		return 0
+	}
+	if opts.vertical() {
+		return float64(slot.Height)
+	}
+	return float64(slot.Width)
+}
+
+// block reports whether the text is placed as a block, see the Text layouts
+func (opts TextOpt) block() bool {
+	return strings.EqualFold(opts.Layout, TextLayoutBlock) || opts.vertical()
+}
+
+// vertical reports whether the text is set in vertical columns
+func (opts TextOpt) vertical() bool {
+	return strings.EqualFold(opts.WritingMode, TextWritingModeVertical)
+}
+
+// fontSizeRange is the smallest and largest size TextOpt.Fit may choose
+func (opts TextOpt) fontSizeRange() (lo, hi float64) {
+	lo, hi = opts.MinFontSize, opts.MaxFontSize
+	if hi <= 0 {
+		hi = opts.FontSize
+	}
+	if hi <= 0 {
+		hi = defaultFontSize
+	}
+	if lo <= 0 {
+		lo = defaultMinFontSize
+	}
+	if lo > hi {
+		lo = hi
+	}
+	return lo, hi
+}
+
+// baseStyle is the style TextOpt sets for the text of a slot
+func (opts TextOpt) baseStyle(chain fontChain) *textStyle {
+	size := opts.FontSize
+	if size <= 0 {
+		size = defaultFontSize
+	}
+	return &textStyle{chain: chain, size: size, color: hexColorOr(opts.Color, color.Black)}
+}
+
+// layoutText lays plain text out in the TextOpt style with the fonts of the chain
+func (slot Slot) layoutText(chain fontChain, text string) textLayout {
+	base := slot.TextOpts.baseStyle(chain)
+	return slot.layoutSpans([]textSpan{{text: text, style: base}}, base)
+}
+
+// layoutSpans lays the spans out, picking the font size as TextOpt.Fit asks
+// and truncating the lines as TextOpt.MaxLines and TextOpt.Overflow ask.
+// base is the TextOpt style, Fit scales every span by the same factor.
+func (slot Slot) layoutSpans(spans []textSpan, base *textStyle) textLayout {
+	opts := slot.TextOpts
+	wrap := slot.wrapWidth()
+	shaper := newTextShaper(opts)
+	layoutAt := func(size float64) textLayout {
+		return layoutSpans(spans, base, size/base.size, wrap, opts.spacing(), shaper)
+	}
+
+	var l textLayout
+	if strings.EqualFold(opts.Fit, TextFitShrink) && len(base.chain.keys) > 0 {
+		l = slot.fitText(layoutAt)
+	} else {
+		l = layoutAt(base.size)
+	}
+
+	suffix := defaultEllipsis
+	if opts.Ellipsis != nil {
+		suffix = *opts.Ellipsis
+	}
+	if strings.EqualFold(opts.Overflow, TextOverflowTruncate) {
+		// the slot size along and across the lines, which are columns in vertical text
+		along, across := float64(slot.Width), float64(slot.Height)
+		if opts.vertical() {
+			along, across = across, along
+		}
+		width := wrap
+		if width <= 0 {
+			width = along
+		}
+		l.truncate(opts.MaxLines, across, width, suffix)
+		if width > 0 {
+			l.clip(width, suffix)
+		}
+	} else {
+		l.truncate(opts.MaxLines, 0, wrap, suffix)
+	}
+	return l
+}
+
+// fitText returns the layout at the largest size in TextOpt.fontSizeRange
+// that fits the slot, or at the smallest size when none fits
+func (slot Slot) fitText(layoutAt func(size float64) textLayout) textLayout {
+	w, h := float64(slot.Width), float64(slot.Height)
+	maxLines := slot.TextOpts.MaxLines
+	fits := func(l textLayout) bool {
+		return l.fits(w, h) && (maxLines <= 0 || len(l.lines) <= maxLines)
+	}
+
+	// binary search the sizes lo + i*fitStep for the largest that fits
+	lo, hi := slot.TextOpts.fontSizeRange()
+	best := layoutAt(hi)
+	if fits(best) {
+		return best
+	}
+	best = layoutAt(lo)
+	if !fits(best) {
+		// nothing fits, the text overflows at the smallest size
+		return best
+	}
+	fit, overflow := 0, int((hi-lo)/fitStep)+1
+	for overflow-fit > 1 {
+		i := (fit + overflow) / 2
+		l := layoutAt(lo + float64(i)*fitStep)
+		if fits(l) {
+			fit, best = i, l
+		} else {
+			overflow = i
+		}
+	}
+	return best
+}
+
+// drawEffects draws the lines like draw, with the shadows and stroke of
+// opts beneath them. The glyphs are drawn offscreen first and every effect
+// is made from their coverage. view is the part of dc in the coordinates of
+// box, only the glyphs that can reach it are drawn offscreen.
+func (l textLayout) drawEffects(dc *gg.Context, box, view textBox, opts TextOpt) {
+	var stroke, blur, offset float64
+	if opts.Stroke != nil {
+		stroke = math.Min(opts.Stroke.Width, maxStrokeWidth)
+	}
+	for _, sh := range opts.Shadows {
+		blur = math.Max(blur, math.Min(sh.Blur, maxShadowBlur))
+		offset = math.Max(offset, math.Max(math.Abs(sh.OffsetX), math.Abs(sh.OffsetY)))
+	}
+	var ascent float64
+	for _, line := range l.lines {
+		ascent = math.Max(ascent, line.ascent)
+	}
+
+	// cover the box and the lines, which can be wider than the box, and leave
+	// room around them for overhanging glyphs, the stroke and the blur
+	x0, y0, x1, y1 := box.x, box.y, box.x+box.w, box.y+box.h
+	for _, r := range l.lineRects(box) {
+		x0, y0 = math.Min(x0, r.x), math.Min(y0, r.y)
+		x1, y1 = math.Max(x1, r.x+r.w), math.Max(y1, r.y+r.h)
+	}
+	pad := math.Ceil(ascent/2 + stroke + 2*blur)
+	// and clip that to the view, grown by the effects that reach into it
+	margin := math.Ceil(stroke + 2*blur + offset)
+	x0, y0 = math.Max(x0-pad, view.x-margin), math.Max(y0-pad, view.y-margin)
+	x1, y1 = math.Min(x1+pad, view.x+view.w+margin), math.Min(y1+pad, view.y+view.h+margin)
+	if x1 <= x0 || y1 <= y0 {
+		return
+	}
+	ox, oy := math.Floor(x0), math.Floor(y0)
+	w := int(math.Ceil(x1 - ox))
+	h := int(math.Ceil(y1 - oy))
+
+	glyphs := gg.NewContext(w, h)
+	inner := box
+	inner.x, inner.y = box.x-ox, box.y-oy
+	l.draw(glyphs, inner)
+	fill := glyphs.Image()
+
+	// shadows follow the outline of stroked text
+	shape := alphaOf(fill)
+	if stroke > 0 {
+		shape = dilateAlpha(shape, stroke)
+	}
+	for _, sh := range opts.Shadows {
+		m := image.NewAlpha(shape.Bounds())
+		copy(m.Pix, shape.Pix)
+		// the blur radius is two standard deviations, as in CSS
+		blurAlpha(m, math.Min(sh.Blur, maxShadowBlur)/2)
+		scaleAlpha(m, sh.EffectiveOpacity())
+		dc.DrawImage(fillAlpha(m, hexColorOr(sh.Color, color.Black)), int(ox+math.Round(sh.OffsetX)), int(oy+math.Round(sh.OffsetY)))
+	}
+	if stroke > 0 {
+		dc.DrawImage(fillAlpha(shape, hexColorOr(opts.Stroke.Color, color.Black)), int(ox), int(oy))
+	}
+	dc.DrawImage(fill, int(ox), int(oy))
+}
+
+// hexColorOr parses a hex color, returning def for empty or invalid colors
+func hexColorOr(s string, def color.Color) color.Color {
+	if s == "" {
+		return def
+	}
+	c, err := parseHexColor(s)
+	if err != nil {
+		return def
+	}
+	return c
+}
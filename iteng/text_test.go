@@ -0,0 +1,751 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+// plainLayout lays text out in the default font without fitting or truncating it
+func plainLayout(size float64, text string, wrapWidth float64, spacing textSpacing) textLayout {
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	base := TextOpt{FontSize: size}.baseStyle(chain)
+	return layoutSpans([]textSpan{{text: text, style: base}}, base, 1, wrapWidth, spacing, nil)
+}
+
+func Test_layoutText_Wrap(t *testing.T) {
+	face, err := DefaultFontRegistry.Face(DefaultFont, 20)
+	if err != nil {
+		t.Fatalf("Face returned error: %v", err)
+	}
+	width := measureText(face, "the quick brown")
+
+	l := plainLayout(20, "the quick brown fox jumps\nover", width, TextOpt{}.spacing())
+	expected := []string{"the quick brown", "fox jumps", "over"}
+	if strings.Join(l.texts(), "|") != strings.Join(expected, "|") {
+		t.Fatalf("lines = %q; expected %q", l.texts(), expected)
+	}
+	if l.width > width {
+		t.Errorf("layout width %g is wider than the wrap width %g", l.width, width)
+	}
+
+	// a word wider than the wrap width gets its own line
+	l = plainLayout(20, "a extraordinarily b", measureText(face, "a b"), TextOpt{}.spacing())
+	expected = []string{"a", "extraordinarily", "b"}
+	if strings.Join(l.texts(), "|") != strings.Join(expected, "|") {
+		t.Errorf("lines = %q; expected %q", l.texts(), expected)
+	}
+}
+
+func Test_layoutText_Fit(t *testing.T) {
+	res, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	if res.FontFallback {
+		t.Fatalf("default font did not load: %v", res.FontErr)
+	}
+
+	slot := Slot{Width: 200, Height: 60, IsText: true, TextOpts: TextOpt{
+		Fit:         TextFitShrink,
+		MaxFontSize: 48,
+		Wrap:        true,
+		Layout:      TextLayoutBlock,
+	}}
+
+	short := slot.layoutText(chain, "Sale")
+	if short.size != 48 {
+		t.Errorf("short title drawn at %g; expected the max size 48", short.size)
+	}
+
+	long := slot.layoutText(chain, "Introducing text rendering that shrinks long titles")
+	if long.size >= 48 || long.size < defaultMinFontSize {
+		t.Errorf("long title drawn at %g; expected a size between %d and 48", long.size, defaultMinFontSize)
+	}
+	if !long.fits(200, 60) {
+		t.Errorf("long title at %g is %gx%g; expected it to fit 200x60", long.size, long.width, long.height)
+	}
+	if larger := slot.layoutText(chain, ""); larger.size != 48 {
+		t.Errorf("empty text drawn at %g; expected 48", larger.size)
+	}
+	next := plainLayout(long.size+fitStep, "Introducing text rendering that shrinks long titles", 200, TextOpt{}.spacing())
+	if next.fits(200, 60) {
+		t.Errorf("size %g also fits, expected the largest size that fits", next.size)
+	}
+
+	// nothing fits, the text is drawn at the min size
+	slot.TextOpts.MinFontSize = 30
+	if l := slot.layoutText(chain, strings.Repeat("overflowing ", 20)); l.size != 30 {
+		t.Errorf("overflowing text drawn at %g; expected the min size 30", l.size)
+	}
+
+	// without fit the font size is used as is
+	slot.TextOpts = TextOpt{FontSize: 40}
+	if l := slot.layoutText(chain, strings.Repeat("overflowing ", 20)); l.size != 40 {
+		t.Errorf("text without fit drawn at %g; expected 40", l.size)
+	}
+}
+
+func Test_layoutText_MaxLines(t *testing.T) {
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	text := "one two three four five six seven eight nine ten"
+	slot := Slot{Width: 100, Height: 40, IsText: true, TextOpts: TextOpt{FontSize: 20, Wrap: true, Layout: TextLayoutBlock, MaxLines: 2}}
+
+	l := slot.layoutText(chain, text)
+	if len(l.lines) != 2 || !l.truncated {
+		t.Fatalf("lines = %q; expected 2 truncated lines", l.texts())
+	}
+	if !strings.HasSuffix(l.lines[1].text(), defaultEllipsis) {
+		t.Errorf("last line %q does not end with %q", l.lines[1].text(), defaultEllipsis)
+	}
+	if l.width > 100 {
+		t.Errorf("truncated text is %g wide; expected at most the wrap width 100", l.width)
+	}
+
+	slot.TextOpts.Ellipsis = String(" [more]")
+	l = slot.layoutText(chain, text)
+	if !strings.HasSuffix(l.lines[1].text(), " [more]") {
+		t.Errorf("last line %q does not end with the custom suffix", l.lines[1].text())
+	}
+
+	slot.TextOpts.Ellipsis = String("")
+	l = slot.layoutText(chain, text)
+	if strings.HasSuffix(l.lines[1].text(), defaultEllipsis) {
+		t.Errorf("last line %q ends with an ellipsis; expected none", l.lines[1].text())
+	}
+
+	// short text is left alone
+	if l := slot.layoutText(chain, "one"); l.truncated || l.lines[0].text() != "one" {
+		t.Errorf("short text was truncated to %q", l.texts())
+	}
+}
+
+func Test_layoutText_OverflowTruncate(t *testing.T) {
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	text := "one two three four five six seven eight nine ten"
+	slot := Slot{Width: 100, Height: 60, IsText: true, TextOpts: TextOpt{FontSize: 20, Wrap: true, Layout: TextLayoutBlock}}
+
+	// without truncation the text spills past the slot
+	if l := slot.layoutText(chain, text); l.height <= 60 {
+		t.Fatalf("text height %g fits the slot; expected it to overflow", l.height)
+	}
+
+	slot.TextOpts.Overflow = TextOverflowTruncate
+	l := slot.layoutText(chain, text)
+	if !l.truncated || l.height > 60 {
+		t.Errorf("truncated text is %g high; expected at most the slot height 60", l.height)
+	}
+	if !strings.HasSuffix(l.lines[len(l.lines)-1].text(), defaultEllipsis) {
+		t.Errorf("last line %q does not end with %q", l.lines[len(l.lines)-1].text(), defaultEllipsis)
+	}
+
+	// a single line is shortened to the slot width
+	slot.TextOpts.Wrap = false
+	l = slot.layoutText(chain, text)
+	if len(l.lines) != 1 || l.width > 100 || !strings.HasSuffix(l.lines[0].text(), defaultEllipsis) {
+		t.Errorf("single line = %q, %g wide; expected it shortened to 100", l.texts(), l.width)
+	}
+}
+
+func Test_layoutText_TruncateNarrow(t *testing.T) {
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	// slots narrower than the ellipsis keep only the ellipsis
+	tests := []struct {
+		name string
+		slot Slot
+		text string
+	}{
+		{"single line", Slot{Width: 5, TextOpts: TextOpt{FontSize: 20, Overflow: TextOverflowTruncate}}, "a b"},
+		{"trailing spaces", Slot{Width: 5, TextOpts: TextOpt{FontSize: 20, Overflow: TextOverflowTruncate}}, "ab  "},
+		{"wrapped", Slot{TextOpts: TextOpt{FontSize: 20, Wrap: true, MaxWidth: 1, Overflow: TextOverflowTruncate}}, "Hello world"},
+		{"max lines", Slot{TextOpts: TextOpt{FontSize: 20, Wrap: true, MaxWidth: 1, MaxLines: 1}}, "Hello world"},
+	}
+	for _, tt := range tests {
+		tt.slot.IsText = true
+		l := tt.slot.layoutText(chain, tt.text)
+		if !l.truncated || l.lines[len(l.lines)-1].text() != defaultEllipsis {
+			t.Errorf("%s: lines = %q; expected them to end with only %q", tt.name, l.texts(), defaultEllipsis)
+		}
+	}
+}
+
+func Test_layoutText_Spacing(t *testing.T) {
+	face, err := DefaultFontRegistry.Face(DefaultFont, 20)
+	if err != nil {
+		t.Fatalf("Face returned error: %v", err)
+	}
+	plain := plainLayout(20, "abc\ndef\nghi", 0, TextOpt{}.spacing())
+	spaced := plainLayout(20, "abc\ndef\nghi", 0, TextOpt{LineHeight: 2, LetterSpacing: 5, ParagraphSpacing: 10}.spacing())
+
+	if d := spaced.width - plain.width; d != 10 {
+		t.Errorf("letter spacing added %g to a 3 letter line; expected 10", d)
+	}
+	height := fixedToFloat(face.Metrics().Height)
+	if d := spaced.lines[1].baseline - spaced.lines[0].baseline; d != 2*height+10 {
+		t.Errorf("baselines are %g apart; expected %g", d, 2*height+10)
+	}
+	if d := plain.lines[1].baseline - plain.lines[0].baseline; d != defaultLineSpacing*height {
+		t.Errorf("default baselines are %g apart; expected %g", d, defaultLineSpacing*height)
+	}
+
+	// wrapped lines of a paragraph are not spaced apart
+	wrapped := plainLayout(20, "abc def", measureText(face, "abc"), TextOpt{ParagraphSpacing: 10}.spacing())
+	if d := wrapped.lines[1].baseline - wrapped.lines[0].baseline; d != defaultLineSpacing*height {
+		t.Errorf("wrapped baselines are %g apart; expected %g", d, defaultLineSpacing*height)
+	}
+}
+
+// inkColumns returns the leftmost and rightmost non white columns in rows y0..y1
+func inkColumns(img image.Image, y0, y1 int) (int, int) {
+	left, right := -1, -1
+	for y := y0; y < y1; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r < 0x8000 {
+				if left < 0 || x < left {
+					left = x
+				}
+				if x > right {
+					right = x
+				}
+			}
+		}
+	}
+	return left, right
+}
+
+func Test_DrawTextInto_SingleLinePlacement(t *testing.T) {
+	line := plainLayout(40, "H", 0, TextOpt{}.spacing()).lines[0]
+	ascent, descent, height := line.ascent, line.descent, line.height
+	// baseline returns the row below the ink of an H, which sits on the baseline
+	baseline := func(opts TextOpt) int {
+		dc := gg.NewContext(200, 200)
+		dc.SetRGB(1, 1, 1)
+		dc.Clear()
+		opts.FontSize = 40
+		slot := Slot{X: 20, Y: 100, IsText: true, TextOpts: opts}
+		slot.DrawTextInto(dc, "H")
+		img := dc.Image()
+		row := -1
+		for y := 0; y < 200; y++ {
+			if left, _ := inkColumns(img, y, y+1); left >= 0 {
+				row = y + 1
+			}
+		}
+		return row
+	}
+
+	tests := []struct {
+		opts TextOpt
+		want float64
+	}{
+		// the baseline sits on the anchor, moved down by the font height as gg's DrawStringAnchored does
+		{TextOpt{}, 100},
+		{TextOpt{AlignY: "top"}, 100},
+		{TextOpt{AlignY: "middle"}, 100 + height/2},
+		{TextOpt{AlignY: "bottom"}, 100 + height},
+		{TextOpt{Layout: TextLayoutBaseline, AlignY: "bottom"}, 100 + height},
+		// the block of the line is placed against the anchor: its top, middle or bottom
+		{TextOpt{Layout: TextLayoutBlock}, 100 + ascent},
+		{TextOpt{Layout: TextLayoutBlock, AlignY: "middle"}, 100 + (ascent-descent)/2},
+		{TextOpt{Layout: TextLayoutBlock, AlignY: "bottom"}, 100 - descent},
+	}
+	for _, tt := range tests {
+		if got := baseline(tt.opts); math.Abs(float64(got)-tt.want) > 1 {
+			t.Errorf("layout %q align_y %q puts the baseline at %d; expected %.1f", tt.opts.Layout, tt.opts.AlignY, got, tt.want)
+		}
+	}
+}
+
+func Test_DrawTextInto_BaselineWrap(t *testing.T) {
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	text := "one two three four five six"
+	slot := Slot{Width: 100, IsText: true, TextOpts: TextOpt{FontSize: 20, Wrap: true}}
+
+	// wrap needs max_width, unless the text is a block
+	if l := slot.layoutText(chain, text); len(l.lines) != 1 {
+		t.Errorf("wrap without max_width broke the text into %q; expected one line", l.texts())
+	}
+	slot.TextOpts.MaxWidth = 100
+	if l := slot.layoutText(chain, text); len(l.lines) < 2 {
+		t.Errorf("wrap at max_width left the text on one line")
+	}
+	slot.TextOpts.MaxWidth, slot.TextOpts.Layout = 0, TextLayoutBlock
+	if l := slot.layoutText(chain, text); len(l.lines) < 2 {
+		t.Errorf("block text did not wrap at the slot width")
+	}
+}
+
+func Test_DrawTextInto_WrappedAlignment(t *testing.T) {
+	text := "Lorem ipsum dolor sit amet, consectetur adipiscing elit"
+	// the slot anchor is placed to match the alignment, as in the templates
+	anchors := map[string]float64{"left": 0, "justify": 0, "center": 0.5, "right": 1}
+	draw := func(align string) image.Image {
+		dc := gg.NewContext(300, 200)
+		dc.SetRGB(1, 1, 1)
+		dc.Clear()
+		slot := Slot{X: 10, Y: 10, Width: 280, Height: 180, AnchorX: Float(anchors[align]), IsText: true,
+			TextOpts: TextOpt{FontSize: 20, Wrap: true, Layout: TextLayoutBlock, AlignX: align}}
+		slot.DrawTextInto(dc, text)
+		return dc.Image()
+	}
+
+	// the first line is full width in every alignment, the last is short
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	l := Slot{Width: 280, IsText: true, TextOpts: TextOpt{FontSize: 20, Wrap: true, Layout: TextLayoutBlock}}.layoutText(chain, text)
+	if len(l.lines) < 2 {
+		t.Fatalf("text was not wrapped: %q", l.texts())
+	}
+	last := len(l.lines) - 1
+	top := func(i int) int { return 10 + int(l.lines[i].baseline-l.lines[i].ascent) }
+	bottom := func(i int) int { return 10 + int(l.lines[i].baseline) }
+
+	tests := []struct {
+		align       string
+		left, right int
+	}{
+		{"left", 10, 10 + int(l.lines[last].width)},
+		{"right", 290 - int(l.lines[last].width), 290},
+		{"center", 150 - int(l.lines[last].width/2), 150 + int(l.lines[last].width/2)},
+	}
+	for _, test := range tests {
+		img := draw(test.align)
+		left, right := inkColumns(img, top(last), bottom(last))
+		if left < test.left-3 || left > test.left+3 || right < test.right-3 || right > test.right+3 {
+			t.Errorf("%s aligned last line spans %d..%d; expected about %d..%d", test.align, left, right, test.left, test.right)
+		}
+	}
+
+	img := draw("justify")
+	if left, right := inkColumns(img, top(0), bottom(0)); left > 13 || right < 287 {
+		t.Errorf("justified first line spans %d..%d; expected 10..290", left, right)
+	}
+	if left, right := inkColumns(img, top(last), bottom(last)); left > 13 || right > 10+int(l.lines[last].width)+3 {
+		t.Errorf("justified last line spans %d..%d; expected it left aligned", left, right)
+	}
+}
+
+func Test_DrawTextInto_StrokeAndShadow(t *testing.T) {
+	draw := func(opts TextOpt) *image.RGBA {
+		dc := gg.NewContext(200, 100)
+		dc.SetRGB(0, 0, 1)
+		dc.Clear()
+		opts.FontSize = 40
+		opts.Color = "#ffffff"
+		opts.Layout = TextLayoutBlock
+		slot := Slot{X: 20, Y: 20, Width: 160, Height: 60, IsText: true, TextOpts: opts}
+		slot.DrawTextInto(dc, "HI")
+		return dc.Image().(*image.RGBA)
+	}
+	count := func(img *image.RGBA, match func(r, g, b uint8) bool) int {
+		n := 0
+		for i := 0; i < len(img.Pix); i += 4 {
+			if match(img.Pix[i], img.Pix[i+1], img.Pix[i+2]) {
+				n++
+			}
+		}
+		return n
+	}
+	white := func(r, g, b uint8) bool { return r > 250 && g > 250 && b > 250 }
+	red := func(r, g, b uint8) bool { return r > 200 && g < 50 && b < 50 }
+	green := func(r, g, b uint8) bool { return g > 200 && r < 50 && b < 50 }
+
+	plain := draw(TextOpt{})
+	glyphs := count(plain, white)
+	if glyphs == 0 {
+		t.Fatalf("no text was drawn")
+	}
+
+	stroked := draw(TextOpt{Stroke: &TextStroke{Color: "#ff0000", Width: 3}})
+	if n := count(stroked, white); n < glyphs*9/10 || n > glyphs*11/10 {
+		t.Errorf("stroke changed the glyph fill from %d to %d pixels", glyphs, n)
+	}
+	if n := count(stroked, red); n < glyphs/2 {
+		t.Errorf("stroke drew %d pixels; expected an outline around %d glyph pixels", n, glyphs)
+	}
+
+	shadowed := draw(TextOpt{Shadows: []TextShadow{{OffsetX: 10, OffsetY: 10, Color: "#00ff00"}}})
+	if n := count(shadowed, white); n != glyphs {
+		t.Errorf("shadow changed the glyph fill from %d to %d pixels", glyphs, n)
+	}
+	// the shadow is only visible where the offset glyphs are not covered by the text
+	if n := count(shadowed, green); n == 0 || n > glyphs*11/10 {
+		t.Errorf("shadow drew %d pixels; expected up to %d", n, glyphs)
+	}
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 200; x++ {
+			if c := shadowed.RGBAAt(x, y); c.G > 50 && c.R < 50 {
+				t.Fatalf("shadow pixel at %d,%d, above the offset text", x, y)
+			}
+		}
+	}
+
+	// a transparent blurred shadow only tints the background
+	faint := draw(TextOpt{Shadows: []TextShadow{{Blur: 6, Color: "#00ff00", Opacity: Float(0.5)}}})
+	if n := count(faint, green); n != 0 {
+		t.Errorf("half transparent shadow drew %d solid pixels", n)
+	}
+	if n := count(faint, func(r, g, b uint8) bool { return g > 20 && b > 100 }); n == 0 {
+		t.Errorf("blurred shadow is not visible")
+	}
+}
+
+func Test_DrawTextInto_StrokeLongWord(t *testing.T) {
+	// a word longer than the wrap width overflows the text box
+	draw := func(stroke *TextStroke) image.Image {
+		dc := gg.NewContext(320, 100)
+		dc.SetRGB(1, 1, 1)
+		dc.Clear()
+		slot := Slot{X: 20, Y: 20, IsText: true, TextOpts: TextOpt{FontSize: 30, Wrap: true, MaxWidth: 40, Stroke: stroke}}
+		slot.DrawTextInto(dc, "Supercalifragilistic")
+		return dc.Image()
+	}
+
+	left, right := inkColumns(draw(nil), 0, 100)
+	if right-left < 200 {
+		t.Fatalf("plain word spans %d..%d; expected it past the wrap width", left, right)
+	}
+	sl, sr := inkColumns(draw(&TextStroke{Width: 1}), 0, 100)
+	if sl < left-2 || sl > left || sr < right || sr > right+2 {
+		t.Errorf("stroked word spans %d..%d; expected the plain %d..%d and the stroke", sl, sr, left, right)
+	}
+}
+
+func Test_DrawTextInto_LargeEffects(t *testing.T) {
+	// effects past their bounds are drawn at the bounds, offscreen only around the canvas
+	dc := gg.NewContext(100, 60)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	slot := Slot{X: 10, Y: 10, Rotation: 30, IsText: true, TextOpts: TextOpt{FontSize: 30,
+		Stroke: &TextStroke{Width: 10000}, Shadows: []TextShadow{{Blur: 100000, OffsetX: 5000}}}}
+	slot.DrawTextInto(dc, "Hi")
+	if left, _ := inkColumns(dc.Image(), 0, 60); left < 0 {
+		t.Errorf("text with large effects was not drawn")
+	}
+}
+
+func Test_layoutSpans_WrapAcrossSpans(t *testing.T) {
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	base := TextOpt{FontSize: 20}.baseStyle(chain)
+	big := &textStyle{chain: chain, size: 40, color: color.Black}
+	spans := []textSpan{
+		{text: "Now only ", style: base},
+		{text: "$9", style: big},
+		{text: ".99 each while stocks last", style: base},
+	}
+
+	l := layoutSpans(spans, base, 1, 150, TextOpt{}.spacing(), nil)
+	if len(l.lines) < 2 {
+		t.Fatalf("lines = %q; expected the text to wrap", l.texts())
+	}
+	// "$9.99" is one word across two spans and stays on one line
+	found := false
+	for _, line := range l.lines {
+		if strings.Contains(line.text(), "$9.99") {
+			found = true
+			if len(line.runs) < 2 || line.runs[0].style == line.runs[1].style {
+				t.Errorf("line %q was not kept in separate style runs", line.text())
+			}
+		}
+		if line.width > 150 && strings.Contains(line.text(), " ") {
+			t.Errorf("line %q is %g wide; expected at most 150", line.text(), line.width)
+		}
+	}
+	if !found {
+		t.Errorf("lines = %q; expected $9.99 on one line", l.texts())
+	}
+
+	// the line with the large span is taller
+	plain := layoutSpans([]textSpan{{text: "Now only $9.99", style: base}}, base, 1, 0, TextOpt{}.spacing(), nil)
+	mixed := layoutSpans(spans[:2], base, 1, 0, TextOpt{}.spacing(), nil)
+	if mixed.lines[0].ascent <= plain.lines[0].ascent {
+		t.Errorf("line ascent %g with a 40px span; expected more than %g", mixed.lines[0].ascent, plain.lines[0].ascent)
+	}
+
+	// fit scales every span by the same factor
+	scaled := layoutSpans(spans, base, 0.5, 0, TextOpt{}.spacing(), nil)
+	if scaled.size != 10 || scaled.lines[0].runs[1].face.Metrics().Height != l.run("", big).face.Metrics().Height/2 {
+		t.Errorf("spans were not scaled with the text")
+	}
+}
+
+func Test_DrawTextInto_Markup(t *testing.T) {
+	dc := gg.NewContext(300, 60)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	slot := Slot{X: 10, Y: 10, Width: 280, Height: 40, IsText: true,
+		TextOpts: TextOpt{FontSize: 24, Color: "#000000", Markup: true}}
+
+	res, err := slot.DrawTextIntoContext(context.Background(), dc, `Price <span color="#ff0000"><u>$9</u></span>`)
+	if err != nil || res.MarkupErr != nil {
+		t.Fatalf("DrawTextIntoContext returned %v, %v", err, res.MarkupErr)
+	}
+	img := dc.Image().(*image.RGBA)
+	var black, red int
+	for i := 0; i < len(img.Pix); i += 4 {
+		r, g, b := img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+		switch {
+		case r < 50 && g < 50 && b < 50:
+			black++
+		case r > 200 && g < 50 && b < 50:
+			red++
+		}
+	}
+	if black == 0 || red == 0 {
+		t.Errorf("drew %d black and %d red pixels; expected both colors", black, red)
+	}
+
+	// the tags are not drawn when markup is off
+	plain := Slot{Width: 280, IsText: true, TextOpts: TextOpt{FontSize: 24}}
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	if l := plain.layoutText(chain, "<b>x</b>"); l.lines[0].text() != "<b>x</b>" {
+		t.Errorf("plain text was parsed as markup: %q", l.lines[0].text())
+	}
+}
+
+func Test_DrawTextInto_FitReportsSize(t *testing.T) {
+	dc := gg.NewContext(200, 100)
+	slot := Slot{X: 0, Y: 0, Width: 200, Height: 100, IsText: true,
+		TextOpts: TextOpt{Fit: TextFitShrink, MinFontSize: 8, MaxFontSize: 64}}
+
+	res, err := slot.DrawTextIntoContext(context.Background(), dc, "A much longer title than fits at 64")
+	if err != nil {
+		t.Fatalf("DrawTextIntoContext returned error: %v", err)
+	}
+	if res.FontSize <= 8 || res.FontSize >= 64 {
+		t.Errorf("fitted font size = %g; expected a size between 8 and 64", res.FontSize)
+	}
+}
+
+func Test_textBox_rotatedBounds(t *testing.T) {
+	box := textBox{x: 10, y: 20, w: 100, h: 40}
+	tests := []struct {
+		degrees float64
+		want    image.Rectangle
+	}{
+		{0, image.Rect(10, 20, 110, 60)},
+		// a quarter turn clockwise around the top left corner swings the box left of it
+		{90, image.Rect(-30, 20, 10, 120)},
+		{180, image.Rect(-90, -20, 10, 20)},
+	}
+	for _, tt := range tests {
+		if got := box.rotatedBounds(tt.degrees, 10, 20); got != tt.want {
+			t.Errorf("rotatedBounds(%g) = %v; expected %v", tt.degrees, got, tt.want)
+		}
+	}
+	if got := box.rotatedBounds(45, 60, 40); got.Dx() != got.Dy() || got.Dx() < 98 || got.Dx() > 101 {
+		t.Errorf("rotatedBounds(45) = %v; expected a square about 99px wide", got)
+	}
+}
+
+func Test_DrawTextInto_Rotation(t *testing.T) {
+	draw := func(rotation float64) (*image.RGBA, TextResult) {
+		dc := gg.NewContext(200, 200)
+		dc.SetRGB(1, 1, 1)
+		dc.Clear()
+		slot := Slot{X: 100, Y: 100, Rotation: rotation, IsText: true,
+			TextOpts: TextOpt{FontSize: 24, Color: "#000000", AlignX: "center", AlignY: "middle"}}
+		res, err := slot.DrawTextIntoContext(context.Background(), dc, "ROTATED")
+		if err != nil {
+			t.Fatalf("DrawTextIntoContext returned error: %v", err)
+		}
+		return dc.Image().(*image.RGBA), res
+	}
+	inkBounds := func(img *image.RGBA) image.Rectangle {
+		var r image.Rectangle
+		for y := 0; y < 200; y++ {
+			for x := 0; x < 200; x++ {
+				if img.RGBAAt(x, y).R < 128 {
+					r = r.Union(image.Rect(x, y, x+1, y+1))
+				}
+			}
+		}
+		return r
+	}
+
+	flat, flatRes := draw(0)
+	upright, uprightRes := draw(90)
+	fb, ub := inkBounds(flat), inkBounds(upright)
+	if fb.Dx() <= fb.Dy() || ub.Dy() <= ub.Dx() {
+		t.Fatalf("ink %v at 0 degrees and %v at 90; expected the text turned upright", fb, ub)
+	}
+	// the text turns around its anchor, the center of the aligned text
+	if c := ub.Min.Add(ub.Max).Div(2); c.X < 95 || c.X > 105 || c.Y < 95 || c.Y > 105 {
+		t.Errorf("rotated ink is centered on %v; expected about 100,100", c)
+	}
+
+	// the report has the box after rotation
+	fr, ur := flatRes.Bounds, uprightRes.Bounds
+	if ur.Dx() != fr.Dy() || ur.Dy() != fr.Dx() {
+		t.Errorf("bounds %v at 90 degrees; expected %v turned", ur, fr)
+	}
+	if !ub.In(ur.Inset(-2)) {
+		t.Errorf("ink %v is outside the reported bounds %v", ub, ur)
+	}
+}
+
+func Test_layoutText_Vertical(t *testing.T) {
+	_, chain := DefaultFontRegistry.resolveTextFonts(context.Background(), TextOpt{})
+	slot := Slot{Width: 100, Height: 100, IsText: true,
+		TextOpts: TextOpt{FontSize: 20, Wrap: true, WritingMode: TextWritingModeVertical}}
+
+	// columns hold as many one em letters as fit the slot height
+	l := slot.layoutText(chain, "abcdefg")
+	if texts := l.texts(); len(texts) != 2 || texts[0] != "abcde" || texts[1] != "fg" {
+		t.Errorf("columns = %q; expected [abcde fg]", texts)
+	}
+	if l.width != 100 {
+		t.Errorf("column length = %g; expected 100", l.width)
+	}
+	// and spaces do not start a column
+	l = slot.layoutText(chain, "abcde fg")
+	if texts := l.texts(); len(texts) != 2 || texts[1] != "fg" {
+		t.Errorf("columns = %q; expected [abcde fg]", texts)
+	}
+
+	// fit compares the column length with the slot height
+	slot.Height = 200
+	slot.TextOpts.Wrap = false
+	slot.TextOpts.Fit = TextFitShrink
+	slot.TextOpts.MaxFontSize = 40
+	if l := slot.layoutText(chain, "abcdefghij"); l.size != 20 {
+		t.Errorf("fitted size = %g; expected 20 for ten letters in 200px", l.size)
+	}
+}
+
+func Test_DrawTextInto_Vertical(t *testing.T) {
+	dc := gg.NewContext(200, 200)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	slot := Slot{X: 50, Y: 20, Width: 100, Height: 160, IsText: true, TextOpts: TextOpt{
+		FontSize: 32, Color: "#000000", Markup: true, Wrap: true, MaxWidth: 64, WritingMode: TextWritingModeVertical}}
+	if _, err := slot.DrawTextIntoContext(context.Background(), dc, `<span color="#ff0000">AB</span>CD`); err != nil {
+		t.Fatalf("DrawTextIntoContext returned error: %v", err)
+	}
+	img := dc.Image().(*image.RGBA)
+
+	// AB is the first column, on the right, and each column runs down
+	var red, black image.Rectangle
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 200; x++ {
+			c := img.RGBAAt(x, y)
+			switch {
+			case c.R > 200 && c.G < 80:
+				red = red.Union(image.Rect(x, y, x+1, y+1))
+			case c.R < 80 && c.G < 80:
+				black = black.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if red.Empty() || black.Empty() {
+		t.Fatalf("red ink %v, black ink %v; expected both columns", red, black)
+	}
+	if red.Min.X <= black.Max.X {
+		t.Errorf("red column %v is not right of the black column %v", red, black)
+	}
+	if red.Dy() <= red.Dx() || red.Min.Y < 20 || red.Max.Y > 20+64 {
+		t.Errorf("red column %v; expected it to run down from the top of the slot", red)
+	}
+}
+
+func Test_textLayout_backgroundRects(t *testing.T) {
+	l := plainLayout(20, "a long first line\nshort", 0, TextOpt{}.spacing())
+	box := textBox{x: 10, y: 20, w: l.width, h: l.height, align: 0.5}
+
+	lines := l.backgroundRects(box, TextBackground{Mode: TextBackgroundLines, Padding: 4})
+	if len(lines) != 2 {
+		t.Fatalf("lines mode made %d boxes; expected one per line", len(lines))
+	}
+	if lines[1].w >= lines[0].w || lines[1].w != l.lines[1].width+8 {
+		t.Errorf("short line box is %g wide; expected its width %g and the padding", lines[1].w, l.lines[1].width)
+	}
+	// the short line is centered, so is its box
+	if c0, c1 := lines[0].x+lines[0].w/2, lines[1].x+lines[1].w/2; c0-c1 > 0.01 || c1-c0 > 0.01 {
+		t.Errorf("line boxes centered at %g and %g; expected the same center", c0, c1)
+	}
+
+	block := l.backgroundRects(box, TextBackground{Padding: 4})
+	if len(block) != 1 {
+		t.Fatalf("block mode made %d boxes; expected one", len(block))
+	}
+	b := block[0]
+	if b.x != lines[0].x || b.w != lines[0].w || b.y != lines[0].y || b.y+b.h != lines[1].y+lines[1].h {
+		t.Errorf("block box %+v does not cover the line boxes %+v", b, lines)
+	}
+
+	// blank lines get no box
+	l = plainLayout(20, "a\n\nb", 0, TextOpt{}.spacing())
+	if n := len(l.backgroundRects(textBox{w: l.width, h: l.height}, TextBackground{Mode: TextBackgroundLines})); n != 2 {
+		t.Errorf("lines mode made %d boxes for two lines of text; expected 2", n)
+	}
+}
+
+func Test_DrawTextInto_Background(t *testing.T) {
+	draw := func(bg *TextBackground) (*image.RGBA, TextResult) {
+		dc := gg.NewContext(200, 100)
+		dc.SetRGB(1, 1, 1)
+		dc.Clear()
+		slot := Slot{X: 20, Y: 20, Width: 160, Height: 60, IsText: true,
+			TextOpts: TextOpt{FontSize: 20, Color: "#ffffff", Wrap: true, Layout: TextLayoutBlock, Background: bg}}
+		res, err := slot.DrawTextIntoContext(context.Background(), dc, "caption on a photo")
+		if err != nil {
+			t.Fatalf("DrawTextIntoContext returned error: %v", err)
+		}
+		return dc.Image().(*image.RGBA), res
+	}
+
+	plain, plainRes := draw(nil)
+	img, res := draw(&TextBackground{Color: "#000000", Padding: 6, Radius: 4})
+	// the box covers the padding around the text
+	if c := img.RGBAAt(17, 22); c.R != 0 {
+		t.Errorf("padding pixel is %v; expected the background color", c)
+	}
+	if c := img.RGBAAt(10, 10); c.R != 255 {
+		t.Errorf("pixel outside the box is %v; expected it untouched", c)
+	}
+	// the text is drawn over the box
+	if countDark(img) == 0 || countDark(plain) != 0 {
+		t.Fatalf("white text on white drew dark pixels, or the box was not drawn")
+	}
+	if white := countWhite(img, res.Bounds); white == 0 {
+		t.Errorf("no text was drawn over the box")
+	}
+	// the report bounds take in the padding
+	if !plainRes.Bounds.In(res.Bounds) || res.Bounds.Min != plainRes.Bounds.Min.Sub(image.Pt(6, 6)) {
+		t.Errorf("bounds %v; expected %v grown by the padding", res.Bounds, plainRes.Bounds)
+	}
+
+	// translucent line boxes that overlap are not darker where they meet
+	img, _ = draw(&TextBackground{Color: "#00000080", Padding: 10, Mode: TextBackgroundLines})
+	if a, b := img.RGBAAt(15, 12), img.RGBAAt(15, 50); a != b || a.R == 255 {
+		t.Errorf("overlapping line boxes are %v and %v; expected one color", a, b)
+	}
+}
+
+// countWhite counts the pixels of img inside r that are mostly white
+func countWhite(img *image.RGBA, r image.Rectangle) int {
+	n := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if c := img.RGBAAt(x, y); c.R > 200 && c.G > 200 && c.B > 200 {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,107 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	imagedraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// transformPad is the transparent border put around a layer before it is
+// transformed, so the resampling filter fades its edges instead of cutting them
+const transformPad = 2
+
+// transformed reports whether an image slot is rotated, flipped or skewed
+func (slot Slot) transformed() bool {
+	return slot.Rotation != 0 || slot.FlipH || slot.FlipV || slot.SkewX != 0 || slot.SkewY != 0
+}
+
+// validSkew reports whether a skew in degrees is between -90 and 90 exclusive
+func validSkew(degrees float64) bool {
+	return degrees > -90 && degrees < 90
+}
+
+// checkSkew returns an error for skews layerTransform does not apply
+func (slot Slot) checkSkew() error {
+	if !validSkew(slot.SkewX) || !validSkew(slot.SkewY) {
+		return fmt.Errorf("skew %g,%g is not between -90 and 90 degrees", slot.SkewX, slot.SkewY)
+	}
+	return nil
+}
+
+// layerTransform maps a w x h image slot layer onto the output. The layer is
+// flipped in place, then skewed and rotated around its anchor point, which
+// is placed at the slot X and Y. Invalid skews are not applied, see checkSkew.
+func (slot Slot) layerTransform(w, h int) f64.Aff3 {
+	ax, ay := slot.EffectiveAnchor()
+
+	// flip: p -> s*p + f
+	sx, sy, fx, fy := 1.0, 1.0, 0.0, 0.0
+	if slot.FlipH {
+		sx, fx = -1, float64(w)
+	}
+	if slot.FlipV {
+		sy, fy = -1, float64(h)
+	}
+
+	// rotation after skew, both in degrees
+	sin, cos := math.Sincos(slot.Rotation * math.Pi / 180)
+	var kx, ky float64
+	if validSkew(slot.SkewX) {
+		kx = math.Tan(slot.SkewX * math.Pi / 180)
+	}
+	if validSkew(slot.SkewY) {
+		ky = math.Tan(slot.SkewY * math.Pi / 180)
+	}
+	a, b := cos-sin*ky, cos*kx-sin
+	c, d := sin+cos*ky, sin*kx+cos
+
+	// move the anchor to the origin before skewing and rotating
+	tx, ty := fx-float64(w)*ax, fy-float64(h)*ay
+	return f64.Aff3{
+		a * sx, b * sy, a*tx + b*ty + float64(slot.X),
+		c * sx, d * sy, c*tx + d*ty + float64(slot.Y),
+	}
+}
+
+// transformLayer resamples layer through m onto a new image in output
+// coordinates, whose bounds are the area the transformed layer covers
+// inside clip
+func transformLayer(layer *image.RGBA, m f64.Aff3, clip image.Rectangle) *image.RGBA {
+	b := layer.Bounds()
+	padded := image.NewRGBA(b.Inset(-transformPad))
+	imagedraw.Copy(padded, b.Min, layer, b, imagedraw.Src, nil)
+
+	dst := image.NewRGBA(affineBounds(m, padded.Bounds()).Intersect(clip))
+	imagedraw.CatmullRom.Transform(dst, m, padded, padded.Bounds(), imagedraw.Src, nil)
+	return dst
+}
+
+// affineBounds is the bounding box of r mapped through m
+func affineBounds(m f64.Aff3, r image.Rectangle) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range []image.Point{r.Min, {r.Max.X, r.Min.Y}, {r.Min.X, r.Max.Y}, r.Max} {
+		x := m[0]*float64(p.X) + m[1]*float64(p.Y) + m[2]
+		y := m[3]*float64(p.X) + m[4]*float64(p.Y) + m[5]
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	return image.Rect(int(math.Floor(minX+1e-9)), int(math.Floor(minY+1e-9)), int(math.Ceil(maxX-1e-9)), int(math.Ceil(maxY-1e-9)))
+}
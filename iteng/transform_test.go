@@ -0,0 +1,146 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// halvesImage is red on the left half and green on the right
+func halvesImage(w, h int) *image.RGBA {
+	img := solidImage(w, h, color.RGBA{255, 0, 0, 255})
+	for y := 0; y < h; y++ {
+		for x := w / 2; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{0, 255, 0, 255})
+		}
+	}
+	return img
+}
+
+func Test_Slot_layerTransform(t *testing.T) {
+	apply := func(slot Slot, x, y float64) (float64, float64) {
+		m := slot.layerTransform(20, 10)
+		return m[0]*x + m[1]*y + m[2], m[3]*x + m[4]*y + m[5]
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+	tests := []struct {
+		name         string
+		slot         Slot
+		x, y, wx, wy float64
+	}{
+		{"none", Slot{X: 5, Y: 7}, 0, 0, 5, 7},
+		{"anchor", Slot{X: 50, Y: 50, AnchorX: Float(0.5), AnchorY: Float(0.5)}, 10, 5, 50, 50},
+		{"flip_h", Slot{X: 5, Y: 7, FlipH: true}, 0, 0, 25, 7},
+		{"flip_v", Slot{X: 5, Y: 7, FlipV: true}, 0, 0, 5, 17},
+		// the left middle of the layer turns up above the anchor
+		{"rotation", Slot{X: 50, Y: 50, AnchorX: Float(0.5), AnchorY: Float(0.5), Rotation: 90}, 0, 5, 50, 40},
+		// the bottom edge slides right
+		{"skew_x", Slot{X: 0, Y: 0, SkewX: 45}, 0, 10, 10, 10},
+		{"skew_y", Slot{X: 0, Y: 0, SkewY: 45}, 20, 0, 20, 20},
+	}
+	for _, tt := range tests {
+		if x, y := apply(tt.slot, tt.x, tt.y); !near(x, tt.wx) || !near(y, tt.wy) {
+			t.Errorf("%s: %g,%g maps to %g,%g; expected %g,%g", tt.name, tt.x, tt.y, x, y, tt.wx, tt.wy)
+		}
+	}
+}
+
+func Test_drawImageInto_Transform(t *testing.T) {
+	draw := func(slot Slot) (*image.RGBA, image.Rectangle) {
+		canvas := solidImage(60, 60, color.RGBA{0, 0, 255, 255})
+		slot.Width, slot.Height, slot.Mode = 20, 10, ResizeModeFill
+		bounds, err := slot.drawImageInto(context.Background(), canvas, halvesImage(20, 10), nil)
+		if err != nil {
+			t.Fatalf("drawImageInto returned error: %v", err)
+		}
+		return canvas, bounds
+	}
+	isRed := func(c color.RGBA) bool { return c.R > 200 && c.G < 50 && c.B < 50 }
+	isGreen := func(c color.RGBA) bool { return c.G > 200 && c.R < 50 && c.B < 50 }
+	isBlue := func(c color.RGBA) bool { return c.B > 200 && c.R < 50 && c.G < 50 }
+
+	img, bounds := draw(Slot{X: 10, Y: 10, FlipH: true})
+	if !isGreen(img.RGBAAt(12, 15)) || !isRed(img.RGBAAt(27, 15)) {
+		t.Errorf("flipped slot is %v on the left and %v on the right; expected green then red", img.RGBAAt(12, 15), img.RGBAAt(27, 15))
+	}
+	if bounds != image.Rect(10, 10, 30, 20) {
+		t.Errorf("flipped slot bounds = %v; expected it in place", bounds)
+	}
+
+	// turned a quarter clockwise around its center the left half is on top
+	img, bounds = draw(Slot{X: 30, Y: 30, AnchorX: Float(0.5), AnchorY: Float(0.5), Rotation: 90})
+	if !isRed(img.RGBAAt(30, 23)) || !isGreen(img.RGBAAt(30, 37)) {
+		t.Errorf("rotated slot is %v above and %v below; expected red then green", img.RGBAAt(30, 23), img.RGBAAt(30, 37))
+	}
+	if !isBlue(img.RGBAAt(22, 30)) {
+		t.Errorf("pixel beside the rotated slot is %v; expected the base", img.RGBAAt(22, 30))
+	}
+	if bounds != image.Rect(25, 20, 35, 40) {
+		t.Errorf("rotated slot bounds = %v; expected 10x20 around the anchor", bounds)
+	}
+
+	// the mask turns with the image, and its edges are resampled
+	img, _ = draw(Slot{X: 30, Y: 30, AnchorX: Float(0.5), AnchorY: Float(0.5), Rotation: 30, Mask: "rounded", Radius: 4, Opacity: Float(0.5)})
+	if c := img.RGBAAt(30, 30); c.B < 100 || c.B > 155 || (c.R < 100 && c.G < 100) {
+		t.Errorf("center of the half opaque slot is %v; expected an even blend with the base", c)
+	}
+	partial := 0
+	for y := 15; y < 45; y++ {
+		for x := 15; x < 45; x++ {
+			if c := img.RGBAAt(x, y); c.B > 140 && c.B < 240 {
+				partial++
+			}
+		}
+	}
+	if partial == 0 {
+		t.Errorf("rotated slot has no blended edge pixels")
+	}
+}
+
+func Test_Render_InvalidSkew(t *testing.T) {
+	base := solidImage(40, 40, color.RGBA{0, 0, 255, 255})
+	loader := func(path string) (image.Image, error) {
+		return halvesImage(20, 10), nil
+	}
+	render := func(slot Slot) *Report {
+		slot.ID = "photo"
+		_, report, err := Render(context.Background(), &Template{Slots: []Slot{slot}}, Inputs{"photo": "photo.png"},
+			WithBaseImage(base), WithImageLoader(loader))
+		if err != nil {
+			t.Fatalf("Render returned error: %v", err)
+		}
+		return report
+	}
+
+	// a skew of 90 degrees is dropped, the slot is still drawn
+	sr := render(Slot{Width: 20, Height: 10, SkewX: 90})
+	if sr.Slots[0].Status != SlotInvalidTransform || sr.Slots[0].Err == nil {
+		t.Errorf("skew of 90 reported %s; expected %s", sr.Slots[0].Status, SlotInvalidTransform)
+	}
+	if b := sr.Slots[0].Bounds; b == nil || b.Width != 20 || b.Height != 10 {
+		t.Errorf("slot without its skew covers %+v; expected 20x10", b)
+	}
+
+	// a steep valid skew only resamples the part on the canvas
+	sr = render(Slot{Width: 2000, Height: 2000, SkewX: 89.99})
+	if sr.Slots[0].Status != SlotRendered {
+		t.Errorf("steep skew reported %s; expected %s", sr.Slots[0].Status, SlotRendered)
+	}
+}
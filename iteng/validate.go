@@ -0,0 +1,480 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Allowed values for the enumerated template fields
+var (
+	resizeModes       = []string{string(ResizeModeFill), string(ResizeModeFit), string(ResizeModeCover), string(ResizeModeSmart)}
+	maskNames         = []string{"circle", "rounded", "rect", "rectangle", "image", "linear", "radial"}
+	fontSources       = []string{"file", "system", "url", "embedded"}
+	alignXValues      = []string{"left", "center", "centre", "right", "justify"}
+	alignYValues      = []string{"top", "middle", "center", "bottom"}
+	textFitModes      = []string{TextFitNone, TextFitShrink}
+	textOverflowModes = []string{TextOverflowVisible, TextOverflowTruncate}
+	textDirections    = []string{TextDirectionAuto, TextDirectionLTR, TextDirectionRTL}
+	textShapings      = []string{TextShapingBasic, TextShapingOpenType}
+	textWritingModes  = []string{TextWritingModeHorizontal, TextWritingModeVertical}
+	textLayouts       = []string{TextLayoutBaseline, TextLayoutBlock}
+	textBackgrounds   = []string{TextBackgroundBlock, TextBackgroundLines}
+	blendModes        = []string{string(BlendNormal), string(BlendMultiply), string(BlendScreen), string(BlendOverlay), string(BlendSoftLight),
+		string(BlendDarken), string(BlendLighten), string(BlendDifference), string(BlendColorDodge)}
+	filterTypes = []string{FilterBlur, FilterGrayscale, FilterSepia, FilterBrightness, FilterContrast,
+		FilterSaturation, FilterHueRotate, FilterInvert, FilterSharpen, FilterTint}
+	outputFormats = []string{"png", "jpg", "jpeg", "gif", "tiff", "bmp"}
+)
+
+// ValidationError is a single problem found in a Template
+type ValidationError struct {
+	// Path is the JSON path of the offending value, e.g. "slots[2].opacity"
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors is every problem found in a Template
+type ValidationErrors []ValidationError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (v *ValidationErrors) add(path, format string, args ...any) {
+	*v = append(*v, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks a parsed Template and returns every problem found,
+// or nil if the template is valid
+func Validate(tmpl *Template) ValidationErrors {
+	var errs ValidationErrors
+	if tmpl == nil {
+		errs.add("", "nil template")
+		return errs
+	}
+
+	if tmpl.TemplateImage == "" {
+		errs.add("template_image", "is required")
+	} else if _, err := os.Stat(tmpl.TemplateImage); err != nil {
+		errs.add("template_image", "file %s is not readable: %v", tmpl.TemplateImage, errors.Unwrap(err))
+	}
+
+	out := tmpl.Output
+	if out.Width < 0 {
+		errs.add("output.width", "must not be negative, got %d", out.Width)
+	}
+	if out.Height < 0 {
+		errs.add("output.height", "must not be negative, got %d", out.Height)
+	}
+	if (out.Width > 0) != (out.Height > 0) {
+		errs.add("output", "width and height must be set together")
+	}
+	if out.Format != "" && !oneOf(strings.ToLower(out.Format), outputFormats) {
+		errs.add("output.format", "unknown format %q, expected one of %s", out.Format, strings.Join(outputFormats, ", "))
+	}
+	validateFilters("filters", tmpl.Filters, &errs)
+
+	seen := make(map[string]int)
+	for i, slot := range tmpl.Slots {
+		path := fmt.Sprintf("slots[%d]", i)
+		if slot.ID == "" {
+			errs.add(path+".id", "is required")
+		} else if first, ok := seen[slot.ID]; ok {
+			errs.add(path+".id", "duplicate id %q, first used by slots[%d]", slot.ID, first)
+		} else {
+			seen[slot.ID] = i
+		}
+		slot.validate(path, &errs)
+	}
+
+	return errs
+}
+
+func (slot Slot) validate(path string, errs *ValidationErrors) {
+	if slot.Width < 0 {
+		errs.add(path+".width", "must not be negative, got %d", slot.Width)
+	}
+	if slot.Height < 0 {
+		errs.add(path+".height", "must not be negative, got %d", slot.Height)
+	}
+	checkUnit(path+".anchor_x", slot.AnchorX, errs)
+	checkUnit(path+".anchor_y", slot.AnchorY, errs)
+
+	if slot.IsText {
+		slot.TextOpts.validate(path+".text_opts", errs)
+		if strings.EqualFold(slot.TextOpts.Fit, TextFitShrink) && slot.Width == 0 && slot.Height == 0 {
+			errs.add(path+".text_opts.fit", "needs the slot width or height to fit the text in")
+		}
+		return
+	}
+
+	checkUnit(path+".opacity", slot.Opacity, errs)
+	if slot.Mask != "" && !oneOf(strings.ToLower(slot.Mask), maskNames) {
+		errs.add(path+".mask", "unknown mask %q, expected one of %s", slot.Mask, strings.Join(maskNames, ", "))
+	}
+	if slot.Radius < 0 {
+		errs.add(path+".radius", "must not be negative, got %g", slot.Radius)
+	}
+	if strings.EqualFold(slot.Mask, "image") {
+		if slot.MaskImage == "" {
+			errs.add(path+".mask_image", "is required for the image mask")
+		} else if _, err := os.Stat(slot.MaskImage); err != nil {
+			errs.add(path+".mask_image", "file %s is not readable: %v", slot.MaskImage, errors.Unwrap(err))
+		}
+	}
+	if slot.MaskFeather < 0 {
+		errs.add(path+".mask_feather", "must not be negative, got %g", slot.MaskFeather)
+	}
+	if g := slot.MaskGradient; g != nil {
+		p := path + ".mask_gradient"
+		if g.Start < 0 || g.Start > 1 {
+			errs.add(p+".start", "must be between 0 and 1, got %g", g.Start)
+		}
+		checkUnit(p+".end", g.End, errs)
+		if g.EffectiveEnd() < g.Start {
+			errs.add(p+".end", "must not be before the start %g, got %g", g.Start, g.EffectiveEnd())
+		}
+		checkUnit(p+".center_x", g.CenterX, errs)
+		checkUnit(p+".center_y", g.CenterY, errs)
+	}
+	if slot.Mode != "" && !oneOf(strings.ToLower(string(slot.Mode)), resizeModes) {
+		errs.add(path+".mode", "unknown resize mode %q, expected one of %s", slot.Mode, strings.Join(resizeModes, ", "))
+	}
+	if slot.Crop != nil {
+		if slot.Crop.X < 0 || slot.Crop.Y < 0 {
+			errs.add(path+".crop", "must not start at a negative position, got %d,%d", slot.Crop.X, slot.Crop.Y)
+		}
+		if slot.Crop.Width <= 0 || slot.Crop.Height <= 0 {
+			errs.add(path+".crop", "must have a positive width and height, got %dx%d", slot.Crop.Width, slot.Crop.Height)
+		}
+	}
+	checkUnit(path+".focus_x", slot.FocusX, errs)
+	checkUnit(path+".focus_y", slot.FocusY, errs)
+	validateFilters(path+".filters", slot.Filters, errs)
+	if slot.BlendMode != "" && !oneOf(strings.ToLower(string(slot.BlendMode)), blendModes) {
+		errs.add(path+".blend_mode", "unknown blend mode %q, expected one of %s", slot.BlendMode, strings.Join(blendModes, ", "))
+	}
+	if slot.SkewX <= -90 || slot.SkewX >= 90 {
+		errs.add(path+".skew_x", "must be between -90 and 90 degrees exclusive, got %g", slot.SkewX)
+	}
+	if slot.SkewY <= -90 || slot.SkewY >= 90 {
+		errs.add(path+".skew_y", "must be between -90 and 90 degrees exclusive, got %g", slot.SkewY)
+	}
+}
+
+func validateFilters(path string, filters []Filter, errs *ValidationErrors) {
+	for i, f := range filters {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		kind := strings.ToLower(f.Type)
+		if !oneOf(kind, filterTypes) {
+			errs.add(p+".type", "unknown filter %q, expected one of %s", f.Type, strings.Join(filterTypes, ", "))
+		}
+		switch kind {
+		case FilterGrayscale, FilterSepia, FilterInvert, FilterTint:
+			checkUnit(p+".amount", f.Amount, errs)
+		default:
+			if f.Amount != nil && *f.Amount < 0 {
+				errs.add(p+".amount", "must not be negative, got %g", *f.Amount)
+			}
+		}
+		if f.Radius < 0 {
+			errs.add(p+".radius", "must not be negative, got %g", f.Radius)
+		}
+		checkColor(p+".color", f.Color, errs)
+	}
+}
+
+func (opts TextOpt) validate(path string, errs *ValidationErrors) {
+	source := strings.ToLower(opts.FontSource)
+	if source != "" && !oneOf(source, fontSources) {
+		errs.add(path+".font_source", "unknown font source %q, expected one of %s", opts.FontSource, strings.Join(fontSources, ", "))
+	}
+	switch source {
+	case "file":
+		if opts.FontPath == "" {
+			errs.add(path+".font_path", "is required when font_source is file")
+		}
+	case "url":
+		if opts.FontURL == "" {
+			errs.add(path+".font_url", "is required when font_source is url")
+		}
+	case "system", "embedded":
+		if opts.FontName == "" {
+			errs.add(path+".font_name", "is required when font_source is %s", source)
+		}
+	}
+	if opts.FontSize < 0 {
+		errs.add(path+".font_size", "must not be negative, got %g", opts.FontSize)
+	}
+	checkColor(path+".color", opts.Color, errs)
+	if opts.AlignX != "" && !oneOf(strings.ToLower(opts.AlignX), alignXValues) {
+		errs.add(path+".align_x", "unknown alignment %q, expected one of %s", opts.AlignX, strings.Join(alignXValues, ", "))
+	}
+	if opts.AlignY != "" && !oneOf(strings.ToLower(opts.AlignY), alignYValues) {
+		errs.add(path+".align_y", "unknown alignment %q, expected one of %s", opts.AlignY, strings.Join(alignYValues, ", "))
+	}
+	if opts.MaxWidth < 0 {
+		errs.add(path+".max_width", "must not be negative, got %d", opts.MaxWidth)
+	}
+	if opts.Fit != "" && !oneOf(strings.ToLower(opts.Fit), textFitModes) {
+		errs.add(path+".fit", "unknown fit mode %q, expected one of %s", opts.Fit, strings.Join(textFitModes, ", "))
+	}
+	if opts.MinFontSize < 0 {
+		errs.add(path+".min_font_size", "must not be negative, got %g", opts.MinFontSize)
+	}
+	if opts.MaxFontSize < 0 {
+		errs.add(path+".max_font_size", "must not be negative, got %g", opts.MaxFontSize)
+	}
+	if opts.LineHeight < 0 {
+		errs.add(path+".line_height", "must not be negative, got %g", opts.LineHeight)
+	}
+	if opts.ParagraphSpacing < 0 {
+		errs.add(path+".paragraph_spacing", "must not be negative, got %g", opts.ParagraphSpacing)
+	}
+	if opts.MaxLines < 0 {
+		errs.add(path+".max_lines", "must not be negative, got %d", opts.MaxLines)
+	}
+	if opts.Overflow != "" && !oneOf(strings.ToLower(opts.Overflow), textOverflowModes) {
+		errs.add(path+".overflow", "unknown overflow mode %q, expected one of %s", opts.Overflow, strings.Join(textOverflowModes, ", "))
+	}
+	if opts.MinFontSize > 0 && opts.MaxFontSize > 0 && opts.MinFontSize > opts.MaxFontSize {
+		errs.add(path+".min_font_size", "must not be larger than max_font_size %g, got %g", opts.MaxFontSize, opts.MinFontSize)
+	}
+	for i, ref := range opts.Fonts {
+		ref.validate(fmt.Sprintf("%s.fonts[%d]", path, i), errs)
+	}
+	if opts.BoldFont != nil {
+		opts.BoldFont.validate(path+".bold_font", errs)
+	}
+	if opts.ItalicFont != nil {
+		opts.ItalicFont.validate(path+".italic_font", errs)
+	}
+	if opts.Stroke != nil {
+		checkColor(path+".stroke.color", opts.Stroke.Color, errs)
+		if opts.Stroke.Width < 0 || opts.Stroke.Width > maxStrokeWidth {
+			errs.add(path+".stroke.width", "must be between 0 and %d, got %g", maxStrokeWidth, opts.Stroke.Width)
+		}
+	}
+	if bg := opts.Background; bg != nil {
+		checkColor(path+".background.color", bg.Color, errs)
+		if bg.Padding < 0 {
+			errs.add(path+".background.padding", "must not be negative, got %g", bg.Padding)
+		}
+		if bg.Radius < 0 {
+			errs.add(path+".background.radius", "must not be negative, got %g", bg.Radius)
+		}
+		if bg.Mode != "" && !oneOf(strings.ToLower(bg.Mode), textBackgrounds) {
+			errs.add(path+".background.mode", "unknown background mode %q, expected one of %s", bg.Mode, strings.Join(textBackgrounds, ", "))
+		}
+	}
+	for i, sh := range opts.Shadows {
+		p := fmt.Sprintf("%s.shadows[%d]", path, i)
+		checkColor(p+".color", sh.Color, errs)
+		if sh.Blur < 0 || sh.Blur > maxShadowBlur {
+			errs.add(p+".blur", "must be between 0 and %d, got %g", maxShadowBlur, sh.Blur)
+		}
+		checkUnit(p+".opacity", sh.Opacity, errs)
+	}
+	if opts.Direction != "" && !oneOf(strings.ToLower(opts.Direction), textDirections) {
+		errs.add(path+".direction", "unknown direction %q, expected one of %s", opts.Direction, strings.Join(textDirections, ", "))
+	}
+	if opts.Shaping != "" && !oneOf(strings.ToLower(opts.Shaping), textShapings) {
+		errs.add(path+".shaping", "unknown shaping %q, expected one of %s", opts.Shaping, strings.Join(textShapings, ", "))
+	}
+	if opts.Layout != "" && !oneOf(strings.ToLower(opts.Layout), textLayouts) {
+		errs.add(path+".layout", "unknown layout %q, expected one of %s", opts.Layout, strings.Join(textLayouts, ", "))
+	}
+	if opts.WritingMode != "" && !oneOf(strings.ToLower(opts.WritingMode), textWritingModes) {
+		errs.add(path+".writing_mode", "unknown writing mode %q, expected one of %s", opts.WritingMode, strings.Join(textWritingModes, ", "))
+	}
+}
+
+func (ref FontRef) validate(path string, errs *ValidationErrors) {
+	source := strings.ToLower(ref.Source)
+	if source != "" && !oneOf(source, fontSources) {
+		errs.add(path+".source", "unknown font source %q, expected one of %s", ref.Source, strings.Join(fontSources, ", "))
+	}
+	switch {
+	case source == "file" && ref.Path == "":
+		errs.add(path+".path", "is required when source is file")
+	case source == "url" && ref.URL == "":
+		errs.add(path+".url", "is required when source is url")
+	case (source == "system" || source == "embedded") && ref.Name == "":
+		errs.add(path+".name", "is required when source is %s", source)
+	case ref.Path == "" && ref.URL == "" && ref.Name == "":
+		errs.add(path, "one of path, url or name is required")
+	}
+}
+
+// checkColor reports invalid hex colors, omitted colors are fine
+func checkColor(path, c string, errs *ValidationErrors) {
+	if c == "" {
+		return
+	}
+	if _, err := parseHexColor(c); err != nil {
+		errs.add(path, "%v, expected #RGB, #RRGGBB or #RRGGBBAA", err)
+	}
+}
+
+// checkUnit reports values outside 0..1, omitted values are fine
+func checkUnit(path string, v *float64, errs *ValidationErrors) {
+	if v != nil && (*v < 0 || *v > 1) {
+		errs.add(path, "must be between 0 and 1, got %g", *v)
+	}
+}
+
+// oneOf reports whether v is one of allowed, ignoring case like the
+// renderer does for every enum field
+func oneOf(v string, allowed []string) bool {
+	for _, a := range allowed {
+		if strings.EqualFold(v, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateFile reads the JSON Template file and validates it.
+// Unlike ParseTemplate it also reports unknown fields.
+func ValidateFile(path string) ValidationErrors {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ValidationErrors{{Message: err.Error()}}
+	}
+	return ValidateJSON(b)
+}
+
+// ValidateJSON validates a JSON encoded Template, including unknown fields
+func ValidateJSON(data []byte) ValidationErrors {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return ValidationErrors{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	var errs ValidationErrors
+	unknownFields(raw, reflect.TypeOf(Template{}), "", &errs)
+
+	var t Template
+	if err := json.Unmarshal(data, &t); err != nil {
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &te) {
+			errs.add(fieldPath(te.Field), "expected %s, got %s", te.Type, te.Value)
+		} else {
+			errs.add("", "%v", err)
+		}
+		return errs
+	}
+
+	return append(errs, Validate(&t)...)
+}
+
+// unknownFields walks the decoded JSON alongside the Go type it decodes into
+// and reports object keys that have no matching field
+func unknownFields(v any, t reflect.Type, path string, errs *ValidationErrors) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			f, ok := fields[k]
+			if !ok {
+				errs.add(joinPath(path, k), "unknown field")
+				continue
+			}
+			unknownFields(obj[k], f.Type, joinPath(path, k), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]any)
+		if !ok {
+			return
+		}
+		for i, e := range arr {
+			unknownFields(e, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+// jsonFields maps the JSON names of the exported struct fields to the fields
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if n, _, _ := strings.Cut(tag, ","); n != "" {
+				name = n
+			}
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// fieldPath converts encoding/json's "slots.0.x" field form to "slots[0].x"
+func fieldPath(field string) string {
+	path := ""
+	for _, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil {
+			path += "[" + part + "]"
+		} else {
+			path = joinPath(path, part)
+		}
+	}
+	return path
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,152 @@
+// Copyright 2022, Initialize All Once Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iteng
+
+import (
+	"testing"
+)
+
+func hasPath(errs ValidationErrors, path string) bool {
+	for _, e := range errs {
+		if e.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidate_Valid(t *testing.T) {
+	tmpl := &Template{
+		TemplateImage: "../test/sun_and_moon_100x100.png",
+		Output:        Output{Width: 100, Height: 50, Format: "PNG"},
+		Slots: []Slot{
+			{ID: "photo", Width: 10, Height: 10, Mask: "circle", Mode: ResizeModeCover, Opacity: Float(0.5)},
+			{ID: "fade", Width: 10, Height: 10, Mask: "Linear", Mode: "Cover", BlendMode: "Multiply"},
+			{ID: "title", IsText: true, TextOpts: TextOpt{FontSize: 12, Color: "#ff0000", AlignX: "Center", AlignY: "middle"}},
+		},
+	}
+	if errs := Validate(tmpl); errs != nil {
+		t.Errorf("Validate returned errors for a valid template:\n%v", errs)
+	}
+}
+
+func TestValidate_Problems(t *testing.T) {
+	tmpl := &Template{
+		TemplateImage: "non-existant-file.png",
+		Output:        Output{Width: -1, Format: "webp"},
+		Filters:       []Filter{{Type: "emboss"}},
+		Slots: []Slot{
+			{ID: "photo", Width: -10, Height: 10, Mask: "star", Mode: "stretch", Opacity: Float(1.5)},
+			{ID: "photo", AnchorX: Float(2), SkewX: 90, SkewY: -120, Crop: &Crop{X: -1}, FocusX: Float(1.2), FocusY: Float(-1), BlendMode: "burn",
+				Filters: []Filter{{Type: FilterSepia, Amount: Float(2)}, {Type: FilterBlur, Radius: -1}, {Type: FilterTint, Color: "orange"}, {Type: FilterBrightness, Amount: Float(-1)}}},
+			{ID: "title", IsText: true, TextOpts: TextOpt{FontSource: "file", Color: "red", AlignX: "middle", Direction: "up", Shaping: "harfbuzz", WritingMode: "sideways", Layout: "grid"}},
+			{ID: "fit", IsText: true, TextOpts: TextOpt{Fit: "shrink", MinFontSize: 20, MaxFontSize: 10, MaxLines: -1, Overflow: "hidden", LineHeight: -1,
+				Stroke: &TextStroke{Width: -1}, Shadows: []TextShadow{{Color: "black", Opacity: Float(2)}, {Blur: 100000}},
+				Background: &TextBackground{Color: "#00000g", Padding: -2, Radius: -1, Mode: "words"}}},
+			{ID: "stroke", Mask: "image", MaskFeather: -4},
+			{ID: "fade", Mask: "image", MaskImage: "non-existant-mask.png", MaskGradient: &MaskGradient{Start: 0.8, End: Float(0.5), CenterY: Float(2)}},
+		},
+	}
+
+	errs := Validate(tmpl)
+	expected := []string{
+		"template_image",
+		"output.width",
+		"output.format",
+		"filters[0].type",
+		"slots[0].width",
+		"slots[0].mask",
+		"slots[0].mode",
+		"slots[0].opacity",
+		"slots[1].id",
+		"slots[1].anchor_x",
+		"slots[1].blend_mode",
+		"slots[1].filters[0].amount",
+		"slots[1].filters[1].radius",
+		"slots[1].filters[2].color",
+		"slots[1].filters[3].amount",
+		"slots[1].crop",
+		"slots[1].focus_x",
+		"slots[1].focus_y",
+		"slots[1].skew_x",
+		"slots[1].skew_y",
+		"slots[2].text_opts.font_path",
+		"slots[2].text_opts.color",
+		"slots[2].text_opts.align_x",
+		"slots[2].text_opts.direction",
+		"slots[2].text_opts.shaping",
+		"slots[2].text_opts.writing_mode",
+		"slots[2].text_opts.layout",
+		"slots[3].text_opts.fit",
+		"slots[3].text_opts.min_font_size",
+		"slots[3].text_opts.max_lines",
+		"slots[3].text_opts.overflow",
+		"slots[3].text_opts.line_height",
+		"slots[3].text_opts.stroke.width",
+		"slots[3].text_opts.shadows[0].color",
+		"slots[3].text_opts.shadows[0].opacity",
+		"slots[3].text_opts.shadows[1].blur",
+		"slots[3].text_opts.background.color",
+		"slots[3].text_opts.background.padding",
+		"slots[3].text_opts.background.radius",
+		"slots[3].text_opts.background.mode",
+		"slots[4].mask_image",
+		"slots[4].mask_feather",
+		"slots[5].mask_image",
+		"slots[5].mask_gradient.end",
+		"slots[5].mask_gradient.center_y",
+	}
+	for _, path := range expected {
+		if !hasPath(errs, path) {
+			t.Errorf("Validate did not report %s, got:\n%v", path, errs)
+		}
+	}
+}
+
+func TestValidateJSON_UnknownFields(t *testing.T) {
+	data := []byte(`{
+		"template_image": "../test/sun_and_moon_100x100.png",
+		"output": {"widht": 10},
+		"slots": [
+			{"id": "a", "text_opts": {"colour": "#fff"}},
+			{"id": "b", "opacity": 0.5, "blend": "multiply"}
+		]
+	}`)
+
+	errs := ValidateJSON(data)
+	for _, path := range []string{"output.widht", "slots[0].text_opts.colour", "slots[1].blend"} {
+		if !hasPath(errs, path) {
+			t.Errorf("ValidateJSON did not report unknown field %s, got:\n%v", path, errs)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("ValidateJSON returned %d errors; expected 3:\n%v", len(errs), errs)
+	}
+}
+
+func TestValidateJSON_BadInput(t *testing.T) {
+	if errs := ValidateJSON([]byte(`{"slots": [`)); len(errs) == 0 {
+		t.Errorf("ValidateJSON should report invalid JSON")
+	}
+	if errs := ValidateJSON([]byte(`{"slots": [{"id": "a", "x": "ten"}]}`)); !hasPath(errs, "slots[0].x") {
+		t.Errorf("ValidateJSON should report the type error, got:\n%v", errs)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	if errs := ValidateFile("non-existant-file.json"); len(errs) == 0 {
+		t.Errorf("ValidateFile should report a missing file")
+	}
+}